@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"sean.mcgivern.me.uk/cricket-query/cricket"
+)
+
+// PageSection is one table on a generated page, like a player's career. Its
+// query uses the usual table aliases, and parameters like $player_id that
+// are filled in as quoted strings. It's run against each projection the
+// page covers and shown as one table with a format column.
+type PageSection struct {
+	Id    string
+	Title string
+	SQL   string
+}
+
+// SectionResult is a section's results, with its query filled in (for one
+// projection) and a link to open that in the editor.
+type SectionResult struct {
+	Section PageSection
+	SQL     string
+	Result  cricket.Result
+	Url     string
+}
+
+var careerSections = []PageSection{
+	{
+		"career",
+		"Career",
+		`WITH
+appearances AS (
+  SELECT match_id FROM innings WHERE player_id = $player_id
+  UNION
+  SELECT match_id FROM bowling_innings WHERE player_id = $player_id
+),
+batting AS (
+  SELECT
+    count(runs) AS innings,
+    sum(CASE WHEN runs IS NOT NULL AND not_out = 'True' THEN 1 ELSE 0 END) AS not_outs,
+    sum(runs) AS runs,
+    max(runs) AS highest,
+    CAST(sum(runs) AS real) / nullif(sum(CASE WHEN runs IS NOT NULL AND not_out = 'False' THEN 1 ELSE 0 END), 0) AS average,
+    100.0 * sum(CASE WHEN bf > 0 THEN runs END) / nullif(sum(CASE WHEN bf > 0 THEN bf END), 0) AS strike_rate,
+    sum(CASE WHEN runs >= 100 THEN 1 ELSE 0 END) AS hundreds,
+    sum(CASE WHEN runs >= 50 AND runs < 100 THEN 1 ELSE 0 END) AS fifties,
+    sum(CASE WHEN runs = 0 AND not_out = 'False' THEN 1 ELSE 0 END) AS ducks
+  FROM innings
+  WHERE player_id = $player_id
+),
+bowling AS (
+  SELECT
+    sum(balls) AS balls,
+    sum(wickets) AS wickets,
+    CAST(sum(runs) AS real) / nullif(sum(wickets), 0) AS bowling_average,
+    6.0 * sum(runs) / nullif(sum(balls), 0) AS economy
+  FROM bowling_innings
+  WHERE player_id = $player_id AND balls IS NOT NULL
+)
+SELECT (SELECT count(*) FROM appearances) AS matches, batting.*, bowling.*
+FROM batting, bowling`,
+	},
+	{
+		"years",
+		"Year by year",
+		`WITH
+appearances AS (
+  SELECT match_id, start_date FROM innings WHERE player_id = $player_id
+  UNION
+  SELECT match_id, start_date FROM bowling_innings WHERE player_id = $player_id
+),
+matches AS (
+  SELECT substr(start_date, 1, 4) AS year, count(*) AS matches
+  FROM appearances
+  GROUP BY 1
+),
+batting AS (
+  SELECT
+    substr(start_date, 1, 4) AS year,
+    count(runs) AS innings,
+    sum(runs) AS runs,
+    max(runs) AS highest,
+    CAST(sum(runs) AS real) / nullif(sum(CASE WHEN runs IS NOT NULL AND not_out = 'False' THEN 1 ELSE 0 END), 0) AS average
+  FROM innings
+  WHERE player_id = $player_id
+  GROUP BY 1
+),
+bowling AS (
+  SELECT
+    substr(start_date, 1, 4) AS year,
+    sum(wickets) AS wickets,
+    CAST(sum(runs) AS real) / nullif(sum(wickets), 0) AS bowling_average
+  FROM bowling_innings
+  WHERE player_id = $player_id AND balls IS NOT NULL
+  GROUP BY 1
+)
+SELECT '''' || year AS year, matches, innings, runs, highest, average, wickets, bowling_average
+FROM matches
+LEFT JOIN batting USING (year)
+LEFT JOIN bowling USING (year)
+ORDER BY year`,
+	},
+	{
+		"best-innings",
+		"Highest scores",
+		`SELECT runs_txt AS score, bf AS balls, fours, sixes, pos, opposition, ground, start_date, match_id
+FROM innings
+WHERE player_id = $player_id AND runs IS NOT NULL
+ORDER BY runs DESC, not_out DESC, start_date
+LIMIT 5`,
+	},
+	{
+		"best-bowling",
+		"Best bowling",
+		`SELECT wickets || '/' || runs AS figures, '''' || overs AS overs, maidens, economy, opposition, ground, start_date, match_id
+FROM bowling_innings
+WHERE player_id = $player_id AND balls IS NOT NULL
+ORDER BY wickets DESC, runs ASC, start_date
+LIMIT 5`,
+	},
+	{
+		"lowest-innings",
+		"Lowest scores",
+		`SELECT runs_txt AS score, bf AS balls, pos, opposition, ground, start_date, match_id
+FROM innings
+WHERE player_id = $player_id AND runs IS NOT NULL AND not_out = 'False'
+ORDER BY runs ASC, bf DESC, start_date
+LIMIT 5`,
+	},
+	{
+		"worst-bowling",
+		"Most expensive bowling",
+		`SELECT wickets || '/' || runs AS figures, '''' || overs AS overs, maidens, economy, opposition, ground, start_date, match_id
+FROM bowling_innings
+WHERE player_id = $player_id AND balls IS NOT NULL
+ORDER BY runs DESC, wickets ASC, start_date
+LIMIT 5`,
+	},
+}
+
+// sqlString quotes s as an SQL string literal.
+func sqlString(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// fillSection replaces a section's parameters with their quoted values.
+func fillSection(sql string, params map[string]string) string {
+	var pairs []string
+
+	for name, value := range params {
+		pairs = append(pairs, name, sqlString(value))
+	}
+
+	return strings.NewReplacer(pairs...).Replace(sql)
+}
+
+// unionProjections runs sql against each of the projections (like
+// "men-test") and puts the results together, with the projection as the
+// first column.
+func unionProjections(sql string, ids []string) string {
+	var parts []string
+
+	for _, gender := range cricket.GenderValues {
+		for _, format := range cricket.FormatValues {
+			if inArray(fmt.Sprintf("%s-%s", gender.Value, format.Value), ids) {
+				parts = append(parts, fmt.Sprintf(
+					"SELECT %s AS format, * FROM (%s)",
+					sqlString(fmt.Sprintf("%s's %s", gender.Label, format.Label)),
+					cricket.AddAliases(gender.Value, format.Value, sql),
+				))
+			}
+		}
+	}
+
+	return strings.Join(parts, "\nUNION ALL\n") + ";"
+}
+
+// projectionValues splits projection IDs into the formats and genders to
+// check for them in the editor.
+func projectionValues(ids []string) (formats []string, genders []string) {
+	for _, id := range ids {
+		parts := strings.SplitN(id, "-", 2)
+
+		if !inArray(parts[0], genders) {
+			genders = append(genders, parts[0])
+		}
+
+		if !inArray(parts[1], formats) {
+			formats = append(formats, parts[1])
+		}
+	}
+
+	return
+}
+
+// runSections runs each section against the projections. Each section is
+// one query, however many projections there are, so that a page view
+// doesn't use up much of a client's rate limit.
+func (e *Engine) runSections(ctx context.Context, sections []PageSection, params map[string]string, ids []string) (out []SectionResult) {
+	for _, section := range sections {
+		sql := fillSection(section.SQL, params)
+
+		out = append(out, SectionResult{
+			Section: section,
+			SQL:     sql + ";",
+			Result:  e.RunQuery(ctx, unionProjections(sql, ids), e.RowsLimit, e.Timeout),
+		})
+	}
+
+	return
+}
+
+func (e *Engine) playerCareer(ctx context.Context, p Player) []SectionResult {
+	return e.runSections(ctx, careerSections, map[string]string{"$player_id": p.Id}, p.Formats)
+}
+
+// linkSections links each result to its query in the editor, with the
+// projections checked.
+func (s *Server) linkSections(results []SectionResult, ids []string, dataset string) {
+	formats, genders := projectionValues(ids)
+
+	for i := range results {
+		values := url.Values{"sql": []string{results[i].SQL}, "format": formats, "gender": genders}
+
+		if dataset != cricket.DefaultDataset {
+			values.Set("dataset", dataset)
+		}
+
+		results[i].Url = s.baseUrl("/?" + values.Encode())
+	}
+}
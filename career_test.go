@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"sean.mcgivern.me.uk/cricket-query/cricket"
+)
+
+func TestFillSection(t *testing.T) {
+	cases := []struct {
+		sql      string
+		params   map[string]string
+		expected string
+	}{
+		{"WHERE player_id = $player_id", map[string]string{"$player_id": "p1"}, "WHERE player_id = 'p1'"},
+		{"WHERE team = $team AND opposition = $opposition", map[string]string{"$team": "Australia", "$opposition": "England"}, "WHERE team = 'Australia' AND opposition = 'England'"},
+		{"WHERE ground = $ground", map[string]string{"$ground": "Lord's"}, "WHERE ground = 'Lord''s'"},
+		{"WHERE ground = $ground", map[string]string{}, "WHERE ground = $ground"},
+	}
+
+	for _, c := range cases {
+		if result := fillSection(c.sql, c.params); result != c.expected {
+			t.Errorf("fillSection(%q, %v) == %q, want %q", c.sql, c.params, result, c.expected)
+		}
+	}
+}
+
+func TestUnionProjections(t *testing.T) {
+	sql := "SELECT runs FROM innings WHERE player_id = 'p1'"
+
+	cases := []struct {
+		ids      []string
+		contains []string
+		parts    int
+	}{
+		{
+			[]string{"men-test"},
+			[]string{"SELECT 'Men''s Test' AS format, * FROM (", "FROM men_test_batting_innings", "WHERE player_id = 'p1'"},
+			1,
+		},
+		{
+			[]string{"women-odi", "men-t20i"},
+			[]string{"SELECT 'Men''s T20I' AS format", "SELECT 'Women''s ODI' AS format"},
+			2,
+		},
+	}
+
+	for _, c := range cases {
+		result := unionProjections(sql, c.ids)
+
+		for _, expected := range c.contains {
+			if !strings.Contains(result, expected) {
+				t.Errorf("unionProjections(%v) did not contain %q:\n%s", c.ids, expected, result)
+			}
+		}
+
+		if parts := strings.Count(result, "UNION ALL") + 1; parts != c.parts {
+			t.Errorf("unionProjections(%v) has %d parts, want %d", c.ids, parts, c.parts)
+		}
+
+		// Men's projections come first, as they do everywhere else.
+		if c.parts > 1 && strings.Index(result, "Men''s") > strings.Index(result, "Women''s") {
+			t.Errorf("unionProjections(%v) put women's formats first:\n%s", c.ids, result)
+		}
+	}
+}
+
+func TestProjectionValues(t *testing.T) {
+	formats, genders := projectionValues([]string{"men-test", "women-test", "men-odi"})
+
+	if diff := cmp.Diff([]string{"test", "odi"}, formats); diff != "" {
+		t.Errorf("projectionValues() formats mismatch (-expected +result):\n%s", diff)
+	}
+
+	if diff := cmp.Diff([]string{"men", "women"}, genders); diff != "" {
+		t.Errorf("projectionValues() genders mismatch (-expected +result):\n%s", diff)
+	}
+}
+
+func TestPlayerCareer(t *testing.T) {
+	// No one in the test data played more than one format, so this player
+	// has an ODI career with nothing in it.
+	player := Player{Id: "p4091", Formats: []string{"men-test", "men-odi"}}
+	results := testEngine.playerCareer(context.Background(), player)
+
+	if len(results) != len(careerSections) {
+		t.Fatalf("playerCareer(%v) returned %d sections, want %d", player, len(results), len(careerSections))
+	}
+
+	for _, result := range results {
+		if len(result.Result.Messages) > 0 {
+			t.Errorf("playerCareer(%v) section %q returned %v", player, result.Section.Id, result.Result.Messages)
+		}
+	}
+
+	career := results[0].Result
+	expected := [][]any{
+		{"Men's Test", int64(1), int64(1), int64(1), int64(165), int64(165), nil, nil, int64(1), int64(0), int64(0), nil, nil, nil, nil},
+		{"Men's ODI", int64(0), int64(0), nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil},
+	}
+
+	if diff := cmp.Diff(expected, career.Rows); diff != "" {
+		t.Errorf("playerCareer(%v) career mismatch (-expected +result):\n%s", player, diff)
+	}
+
+	if years := results[1].Result; len(years.Rows) != 1 || years.Rows[0][1] != "'1877" || years.Rows[0][4] != int64(165) {
+		t.Errorf("playerCareer(%v) years == %v", player, years.Rows)
+	}
+
+	if best := results[2].Result; len(best.Rows) != 1 || best.Rows[0][1] != "165*" {
+		t.Errorf("playerCareer(%v) highest scores == %v", player, best.Rows)
+	}
+
+	testServer.linkSections(results, player.Formats, cricket.DefaultDataset)
+	link, _ := url.Parse(results[0].Url)
+
+	if query := link.Query(); !strings.HasPrefix(query.Get("sql"), "WITH") || !strings.Contains(query.Get("sql"), "player_id = 'p4091'") || strings.Join(query["format"], ",") != "test,odi" {
+		t.Errorf("linkSections() linked the career to %q", results[0].Url)
+	}
+}
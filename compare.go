@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"sean.mcgivern.me.uk/cricket-query/cricket"
+)
+
+// compare shows two variants of a query side by side. A saved query can be
+// given to start both variants from it.
+func (s *Server) compare(w http.ResponseWriter, r *http.Request) {
+	var compared []cricket.ComparedResult
+
+	r.ParseForm()
+
+	query, ok := s.engine.SavedQueries[r.FormValue("query")]
+	sqlB := query.SQL
+
+	if !ok {
+		query = cricket.Query{
+			SQL:     strings.TrimSpace(r.FormValue("a")),
+			Formats: cricket.CheckboxValues(cricket.FormatValues, r.Form["format"]),
+			Genders: cricket.CheckboxValues(cricket.GenderValues, r.Form["gender"]),
+			Dataset: r.FormValue("dataset"),
+		}
+		sqlB = strings.TrimSpace(r.FormValue("b"))
+	} else if query.Dataset == "" {
+		query.Dataset = r.FormValue("dataset")
+	}
+
+	dataset, ok := s.requestDataset(w, r, query.Dataset)
+	if !ok {
+		return
+	}
+
+	query.Dataset = dataset.Name
+
+	if query.SQL != "" && sqlB != "" {
+		compared = s.engine.ProjectCompare(cricket.WithDataset(r.Context(), dataset.Name), query, sqlB, s.engine.RowsLimit, s.engine.Timeout)
+	}
+
+	s.executeTemplate(w, "compare.html", Page{
+		Title: "Compare queries",
+		Query: query,
+		Content: struct {
+			B        string
+			Compared []cricket.ComparedResult
+			Datasets []cricket.Dataset
+		}{
+			sqlB,
+			compared,
+			s.engine.Datasets,
+		},
+	})
+}
+
+// compareUrl links to the compare page with query as both variants.
+func (s *Server) compareUrl(query cricket.Query) string {
+	values := url.Values{"a": []string{query.SQL}, "b": []string{query.SQL}}
+
+	values["format"] = cricket.CheckedValues(query.Formats)
+	values["gender"] = cricket.CheckedValues(query.Genders)
+
+	if query.Dataset != "" && query.Dataset != cricket.DefaultDataset {
+		values.Set("dataset", query.Dataset)
+	}
+
+	return s.baseUrl("/compare/?" + values.Encode())
+}
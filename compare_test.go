@@ -0,0 +1,60 @@
+package main
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"sean.mcgivern.me.uk/cricket-query/cricket"
+)
+
+func TestCompare(t *testing.T) {
+	cases := []struct {
+		query    url.Values
+		expected []string
+	}{
+		{
+			url.Values{},
+			[]string{`<textarea name="a" id="a"></textarea>`},
+		},
+		{
+			url.Values{
+				"a":      []string{"SELECT 1 AS x UNION SELECT 2;"},
+				"b":      []string{"SELECT 1 AS x UNION SELECT 3;"},
+				"format": []string{"odi"},
+				"gender": []string{"women"},
+			},
+			[]string{"Women&#39;s ODI", "Variant A", "Variant B", `<tr class="only">`},
+		},
+		{
+			url.Values{"query": []string{"bannerwell"}},
+			[]string{"<h2>Bannerwell</h2>", `<textarea name="b" id="b">WITH`, "Men&#39;s Test", "Women&#39;s T20I"},
+		},
+	}
+
+	for _, c := range cases {
+		w := httptest.NewRecorder()
+		testServer.compare(w, httptest.NewRequest("GET", testServer.baseUrl("/compare/?"+c.query.Encode()), nil))
+
+		for _, expected := range c.expected {
+			if !strings.Contains(w.Body.String(), expected) {
+				t.Errorf("compare(%v) does not contain %q:\n%s", c.query, expected, w.Body.String())
+			}
+		}
+	}
+}
+
+func TestCompareUrl(t *testing.T) {
+	query := cricket.Query{
+		SQL:     "SELECT 1;",
+		Formats: cricket.CheckboxValues(cricket.FormatValues, []string{"test"}),
+		Genders: cricket.CheckboxValues(cricket.GenderValues, []string{"men"}),
+		Dataset: cricket.DefaultDataset,
+	}
+	expected := "/cricket-query/compare/?a=SELECT+1%3B&b=SELECT+1%3B&format=test&gender=men"
+
+	if result := testServer.compareUrl(query); result != expected {
+		t.Errorf("compareUrl(%v) == %q, want %q", query, result, expected)
+	}
+}
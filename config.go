@@ -0,0 +1,347 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"sean.mcgivern.me.uk/cricket-query/cricket"
+)
+
+// Config holds the server settings. Each can come from (in increasing order
+// of precedence) the defaults below, a TOML file, an environment variable,
+// or a command-line flag. The setting `base_path` is set in a file as
+// `base_path = "/stats"`, in the environment as CRICKET_QUERY_BASE_PATH, and
+// on the command line as -base-path.
+type Config struct {
+	Address    string `toml:"address"`
+	Port       int    `toml:"port"`
+	BasePath   string `toml:"base_path"`
+	Database   string `toml:"database"`
+	Permalinks string `toml:"permalinks"`
+	RowsLimit  int    `toml:"rows_limit"`
+	Timeout    int    `toml:"timeout"`
+
+	// Diffs compare rows that aren't shown, so they need more of them than
+	// a page of results does.
+	DiffRowsLimit int `toml:"diff_rows_limit"`
+
+	MaxQueries     int      `toml:"max_queries"`
+	QueueTimeout   int      `toml:"queue_timeout"`
+	RateLimit      int      `toml:"rate_limit"`
+	RateBurst      int      `toml:"rate_burst"`
+	TrustedProxies []string `toml:"trusted_proxies"`
+
+	LogLevel  string `toml:"log_level"`
+	LogFormat string `toml:"log_format"`
+	RedactSQL bool   `toml:"redact_sql"`
+
+	InternalLinks bool `toml:"internal_links"`
+
+	ReadTimeout     int `toml:"read_timeout"`
+	WriteTimeout    int `toml:"write_timeout"`
+	IdleTimeout     int `toml:"idle_timeout"`
+	ShutdownTimeout int `toml:"shutdown_timeout"`
+
+	// Datasets can only be set in a file, as [[datasets]] tables.
+	Datasets []cricket.Dataset `toml:"datasets"`
+}
+
+type Setting struct {
+	Name  string
+	Usage string
+	Value any
+}
+
+func defaultConfig() Config {
+	return Config{
+		Address:    "localhost",
+		Port:       8080,
+		BasePath:   "/cricket-query",
+		Database:   "data/innings.sqlite3",
+		Permalinks: "data/permalinks.sqlite3",
+		RowsLimit:  100,
+		Timeout:    5000,
+
+		DiffRowsLimit: 1000,
+
+		MaxQueries:     8,
+		QueueTimeout:   2000,
+		RateLimit:      120,
+		RateBurst:      30,
+		TrustedProxies: []string{},
+
+		LogLevel:  "info",
+		LogFormat: "json",
+		RedactSQL: false,
+
+		InternalLinks: false,
+
+		ReadTimeout:     10000,
+		WriteTimeout:    60000,
+		IdleTimeout:     60000,
+		ShutdownTimeout: 10000,
+
+		Datasets: []cricket.Dataset{},
+	}
+}
+
+func (c *Config) settings() []Setting {
+	return []Setting{
+		{"address", "address to listen on; empty for all interfaces", &c.Address},
+		{"port", "port to listen on", &c.Port},
+		{"base_path", "path prefix for all URLs; empty to serve from /", &c.BasePath},
+		{"database", "path to the innings database", &c.Database},
+		{"permalinks", "path to the permalinks database, created if missing", &c.Permalinks},
+		{"rows_limit", "maximum rows shown for each gender and format", &c.RowsLimit},
+		{"timeout", "query timeout in milliseconds", &c.Timeout},
+		{"diff_rows_limit", "maximum rows compared for each gender and format when diffing datasets", &c.DiffRowsLimit},
+		{"max_queries", "maximum queries running at once", &c.MaxQueries},
+		{"queue_timeout", "milliseconds a query waits for a free slot before giving up", &c.QueueTimeout},
+		{"rate_limit", "requests that run queries allowed per minute from each client; 0 for no limit", &c.RateLimit},
+		{"rate_burst", "requests that run queries a client can make at once before rate_limit applies", &c.RateBurst},
+		{"trusted_proxies", "comma-separated IPs or CIDR ranges whose X-Forwarded-For is trusted", &c.TrustedProxies},
+		{"log_level", "minimum level to log: debug, info, warn or error", &c.LogLevel},
+		{"log_format", "log format: json or text", &c.LogFormat},
+		{"redact_sql", "leave the SQL out of query logs, keeping only its hash", &c.RedactSQL},
+		{"internal_links", "link player and match IDs in results to this server's pages rather than Cricinfo", &c.InternalLinks},
+		{"read_timeout", "milliseconds to wait for a request to be read", &c.ReadTimeout},
+		{"write_timeout", "milliseconds allowed for a response, including all of its queries", &c.WriteTimeout},
+		{"idle_timeout", "milliseconds to keep idle connections open", &c.IdleTimeout},
+		{"shutdown_timeout", "milliseconds to let running requests finish on shutdown before cancelling their queries", &c.ShutdownTimeout},
+	}
+}
+
+func (c *Config) setting(name string) Setting {
+	for _, s := range c.settings() {
+		if s.Name == name {
+			return s
+		}
+	}
+
+	panic("unknown setting: " + name)
+}
+
+func (s Setting) flagName() string {
+	return strings.ReplaceAll(s.Name, "_", "-")
+}
+
+func (s Setting) envName() string {
+	return "CRICKET_QUERY_" + strings.ToUpper(s.Name)
+}
+
+func (s Setting) set(value string) error {
+	switch ptr := s.Value.(type) {
+	case *string:
+		*ptr = value
+	case *int:
+		i, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%s: %q is not an integer", s.Name, value)
+		}
+
+		*ptr = i
+	case *bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%s: %q is not a boolean", s.Name, value)
+		}
+
+		*ptr = b
+	case *[]string:
+		*ptr = []string{}
+
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				*ptr = append(*ptr, item)
+			}
+		}
+	default:
+		return fmt.Errorf("%s: unsupported setting type %T", s.Name, ptr)
+	}
+
+	return nil
+}
+
+func (c *Config) validate() error {
+	var problems []string
+
+	if c.Port < 1 || c.Port > 65535 {
+		problems = append(problems, fmt.Sprintf("port must be between 1 and 65535, not %d", c.Port))
+	}
+
+	if strings.ContainsAny(c.Address, ":/ ") && net.ParseIP(c.Address) == nil {
+		problems = append(problems, fmt.Sprintf("address must be a host name or IP address without a port, not %q", c.Address))
+	}
+
+	if c.BasePath != "" && (!strings.HasPrefix(c.BasePath, "/") || strings.HasSuffix(c.BasePath, "/")) {
+		problems = append(problems, fmt.Sprintf("base_path must start with a slash and not end with one, not %q", c.BasePath))
+	}
+
+	if c.Database == "" {
+		problems = append(problems, "database must be set")
+	}
+
+	if c.Permalinks == "" {
+		problems = append(problems, "permalinks must be set")
+	}
+
+	if c.RowsLimit < 1 {
+		problems = append(problems, fmt.Sprintf("rows_limit must be positive, not %d", c.RowsLimit))
+	}
+
+	if c.DiffRowsLimit < 1 {
+		problems = append(problems, fmt.Sprintf("diff_rows_limit must be positive, not %d", c.DiffRowsLimit))
+	}
+
+	if c.Timeout < 1 {
+		problems = append(problems, fmt.Sprintf("timeout must be positive, not %d", c.Timeout))
+	}
+
+	if c.MaxQueries < 1 {
+		problems = append(problems, fmt.Sprintf("max_queries must be positive, not %d", c.MaxQueries))
+	}
+
+	if c.RateLimit > 0 && c.RateBurst < 1 {
+		problems = append(problems, fmt.Sprintf("rate_burst must be positive when rate_limit is set, not %d", c.RateBurst))
+	}
+
+	if _, ok := logLevel(c.LogLevel); !ok {
+		problems = append(problems, fmt.Sprintf("log_level must be one of %s, not %q", strings.Join(logLevels, ", "), c.LogLevel))
+	}
+
+	if c.LogFormat != "json" && c.LogFormat != "text" {
+		problems = append(problems, fmt.Sprintf("log_format must be json or text, not %q", c.LogFormat))
+	}
+
+	if _, err := parseNetworks(c.TrustedProxies); err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	for _, s := range []Setting{c.setting("queue_timeout"), c.setting("rate_limit"), c.setting("read_timeout"), c.setting("write_timeout"), c.setting("idle_timeout"), c.setting("shutdown_timeout")} {
+		if value := *s.Value.(*int); value < 0 {
+			problems = append(problems, fmt.Sprintf("%s must not be negative, not %d", s.Name, value))
+		}
+	}
+
+	names := map[string]bool{}
+
+	for _, dataset := range c.Datasets {
+		if err := dataset.Validate(); err != nil {
+			problems = append(problems, err.Error())
+		} else if names[dataset.Name] {
+			problems = append(problems, fmt.Sprintf("datasets: %q is used more than once", dataset.Name))
+		}
+
+		names[dataset.Name] = true
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid configuration: %s", strings.Join(problems, "; "))
+	}
+
+	return nil
+}
+
+// loadConfig builds the configuration from the command-line arguments
+// (without the program name) and the environment. It returns whether
+// -print-config was passed, so that main can print it and exit.
+func loadConfig(args []string, lookupEnv func(string) (string, bool), output io.Writer) (c Config, printConfig bool, err error) {
+	var path string
+	var flagged = defaultConfig()
+
+	flags := flag.NewFlagSet("cricket-query", flag.ContinueOnError)
+	flags.SetOutput(output)
+	flags.StringVar(&path, "config", "", "path to a TOML config file (env CRICKET_QUERY_CONFIG)")
+	flags.BoolVar(&printConfig, "print-config", false, "print the configuration as TOML and exit")
+
+	for _, s := range flagged.settings() {
+		usage := fmt.Sprintf("%s (env %s)", s.Usage, s.envName())
+
+		switch ptr := s.Value.(type) {
+		case *string:
+			flags.StringVar(ptr, s.flagName(), *ptr, usage)
+		case *int:
+			flags.IntVar(ptr, s.flagName(), *ptr, usage)
+		case *bool:
+			flags.BoolVar(ptr, s.flagName(), *ptr, usage)
+		case *[]string:
+			flags.String(s.flagName(), strings.Join(*ptr, ","), usage)
+		}
+	}
+
+	if err = flags.Parse(args); err != nil {
+		return
+	}
+
+	c = defaultConfig()
+
+	if path == "" {
+		path, _ = lookupEnv("CRICKET_QUERY_CONFIG")
+	}
+
+	if path != "" {
+		var metadata toml.MetaData
+
+		metadata, err = toml.DecodeFile(path, &c)
+		if err != nil {
+			return
+		}
+
+		if undecoded := metadata.Undecoded(); len(undecoded) > 0 {
+			keys := make([]string, 0, len(undecoded))
+			for _, key := range undecoded {
+				keys = append(keys, key.String())
+			}
+
+			sort.Strings(keys)
+			err = fmt.Errorf("%s: unknown settings: %s", path, strings.Join(keys, ", "))
+			return
+		}
+	}
+
+	// PORT predates the other variables, and is still what some hosts set.
+	if value, ok := lookupEnv("PORT"); ok {
+		if err = c.setting("port").set(value); err != nil {
+			return
+		}
+	}
+
+	for _, s := range c.settings() {
+		if value, ok := lookupEnv(s.envName()); ok {
+			if err = s.set(value); err != nil {
+				return
+			}
+		}
+	}
+
+	flags.Visit(func(f *flag.Flag) {
+		if f.Name != "config" && f.Name != "print-config" && err == nil {
+			err = c.setting(strings.ReplaceAll(f.Name, "-", "_")).set(f.Value.String())
+		}
+	})
+
+	if err == nil {
+		err = c.validate()
+	}
+
+	return
+}
+
+func (c Config) print(w io.Writer) error {
+	return toml.NewEncoder(w).Encode(c)
+}
+
+func (c Config) listenAddress() string {
+	return net.JoinHostPort(c.Address, strconv.Itoa(c.Port))
+}
+
+func milliseconds(n int) time.Duration {
+	return time.Duration(n) * time.Millisecond
+}
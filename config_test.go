@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"sean.mcgivern.me.uk/cricket-query/cricket"
+)
+
+func fakeEnv(env map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		value, ok := env[key]
+
+		return value, ok
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	os.WriteFile(path, []byte(`
+address = ""
+port = 9000
+base_path = "/stats"
+rows_limit = 50
+`), 0644)
+
+	datasets := filepath.Join(t.TempDir(), "datasets.toml")
+	os.WriteFile(datasets, []byte(`
+[[datasets]]
+name = "end-of-2023"
+path = "/srv/innings-2023.sqlite3"
+description = "End of the 2023 season"
+date = "2023-09-30"
+`), 0644)
+
+	cases := []struct {
+		args     []string
+		env      map[string]string
+		expected func(*Config)
+	}{
+		{
+			[]string{},
+			map[string]string{},
+			func(c *Config) {},
+		},
+		{
+			[]string{"-config", path},
+			map[string]string{},
+			func(c *Config) {
+				c.Address = ""
+				c.Port = 9000
+				c.BasePath = "/stats"
+				c.RowsLimit = 50
+			},
+		},
+		{
+			[]string{},
+			map[string]string{"CRICKET_QUERY_CONFIG": path, "CRICKET_QUERY_PORT": "9001", "CRICKET_QUERY_TIMEOUT": "100"},
+			func(c *Config) {
+				c.Address = ""
+				c.Port = 9001
+				c.BasePath = "/stats"
+				c.RowsLimit = 50
+				c.Timeout = 100
+			},
+		},
+		{
+			[]string{"-config", path, "-port", "9002", "--base-path", ""},
+			map[string]string{"CRICKET_QUERY_PORT": "9001", "PORT": "9003"},
+			func(c *Config) {
+				c.Address = ""
+				c.Port = 9002
+				c.BasePath = ""
+				c.RowsLimit = 50
+			},
+		},
+		{
+			[]string{},
+			map[string]string{"PORT": "9003", "CRICKET_QUERY_DATABASE": "/srv/innings.sqlite3"},
+			func(c *Config) {
+				c.Port = 9003
+				c.Database = "/srv/innings.sqlite3"
+			},
+		},
+		{
+			[]string{"-trusted-proxies", "10.0.0.0/8, 192.0.2.1"},
+			map[string]string{"CRICKET_QUERY_TRUSTED_PROXIES": "127.0.0.1"},
+			func(c *Config) {
+				c.TrustedProxies = []string{"10.0.0.0/8", "192.0.2.1"}
+			},
+		},
+		{
+			[]string{},
+			map[string]string{"CRICKET_QUERY_TRUSTED_PROXIES": "127.0.0.1"},
+			func(c *Config) {
+				c.TrustedProxies = []string{"127.0.0.1"}
+			},
+		},
+		{
+			[]string{"-internal-links"},
+			map[string]string{},
+			func(c *Config) {
+				c.InternalLinks = true
+			},
+		},
+		{
+			[]string{"-redact-sql", "-log-format", "text"},
+			map[string]string{"CRICKET_QUERY_LOG_LEVEL": "warn"},
+			func(c *Config) {
+				c.RedactSQL = true
+				c.LogFormat = "text"
+				c.LogLevel = "warn"
+			},
+		},
+		{
+			[]string{"-config", datasets},
+			map[string]string{},
+			func(c *Config) {
+				c.Datasets = []cricket.Dataset{{Name: "end-of-2023", Path: "/srv/innings-2023.sqlite3", Description: "End of the 2023 season", Date: "2023-09-30"}}
+			},
+		},
+	}
+
+	for _, c := range cases {
+		expected := defaultConfig()
+		c.expected(&expected)
+
+		result, printConfig, err := loadConfig(c.args, fakeEnv(c.env), io.Discard)
+
+		if err != nil || printConfig {
+			t.Errorf("loadConfig(%q, %v) returned %v, %v", c.args, c.env, printConfig, err)
+		}
+
+		if diff := cmp.Diff(expected, result); diff != "" {
+			t.Errorf("loadConfig(%q, %v) mismatch (-expected +result):\n%s", c.args, c.env, diff)
+		}
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	os.WriteFile(path, []byte("port = 9000\nrow_limit = 50\n"), 0644)
+
+	datasets := filepath.Join(t.TempDir(), "datasets.toml")
+	os.WriteFile(datasets, []byte(`
+[[datasets]]
+name = "live"
+path = "a.sqlite3"
+
+[[datasets]]
+name = "Snapshot"
+path = "b.sqlite3"
+
+[[datasets]]
+name = "old"
+
+[[datasets]]
+name = "dupe"
+path = "c.sqlite3"
+
+[[datasets]]
+name = "dupe"
+path = "d.sqlite3"
+`), 0644)
+
+	cases := []struct {
+		args     []string
+		env      map[string]string
+		expected string
+	}{
+		{[]string{"-config", path}, map[string]string{}, "unknown settings: row_limit"},
+		{[]string{"-config", "missing.toml"}, map[string]string{}, "no such file"},
+		{[]string{"-port", "none"}, map[string]string{}, "invalid value"},
+		{[]string{}, map[string]string{"PORT": "none"}, `port: "none" is not an integer`},
+		{[]string{"-port", "0"}, map[string]string{}, "port must be between 1 and 65535"},
+		{[]string{"-base-path", "/stats/"}, map[string]string{}, "base_path must start with a slash"},
+		{[]string{"-base-path", "stats"}, map[string]string{}, "base_path must start with a slash"},
+		{[]string{"-address", "localhost:80"}, map[string]string{}, "address must be a host name"},
+		{[]string{"-rows-limit", "0", "-timeout", "-1"}, map[string]string{}, "rows_limit must be positive, not 0; timeout must be positive, not -1"},
+		{[]string{"-database", ""}, map[string]string{}, "database must be set"},
+		{[]string{"-trusted-proxies", "10.0.0.0/8,proxy"}, map[string]string{}, `trusted_proxies: "proxy" is not an IP address`},
+		{[]string{"-max-queries", "0"}, map[string]string{}, "max_queries must be positive"},
+		{[]string{"-log-level", "verbose"}, map[string]string{}, `log_level must be one of debug, info, warn, error, not "verbose"`},
+		{[]string{}, map[string]string{"CRICKET_QUERY_LOG_FORMAT": "xml"}, `log_format must be json or text, not "xml"`},
+		{[]string{}, map[string]string{"CRICKET_QUERY_REDACT_SQL": "maybe"}, `redact_sql: "maybe" is not a boolean`},
+		{[]string{"-config", datasets}, map[string]string{}, `datasets: "live" is the name of the dataset from database; datasets: name must be lowercase letters, digits and dashes, not "Snapshot"; datasets: old: path must be set; datasets: "dupe" is used more than once`},
+	}
+
+	for _, c := range cases {
+		_, _, err := loadConfig(c.args, fakeEnv(c.env), io.Discard)
+
+		if err == nil || !strings.Contains(err.Error(), c.expected) {
+			t.Errorf("loadConfig(%q, %v) returned error %v, want %q", c.args, c.env, err, c.expected)
+		}
+	}
+}
+
+func TestPrintConfig(t *testing.T) {
+	var output bytes.Buffer
+
+	c, printConfig, err := loadConfig([]string{"--print-config", "-address", "0.0.0.0"}, fakeEnv(map[string]string{}), io.Discard)
+
+	if err != nil || !printConfig {
+		t.Fatalf("loadConfig(--print-config) returned %v, %v", printConfig, err)
+	}
+
+	c.print(&output)
+
+	if !strings.Contains(output.String(), `address = "0.0.0.0"`) || !strings.Contains(output.String(), `base_path = "/cricket-query"`) {
+		t.Errorf("print() == %s", output.String())
+	}
+
+	if c.listenAddress() != "0.0.0.0:8080" {
+		t.Errorf("listenAddress() == %s, want 0.0.0.0:8080", c.listenAddress())
+	}
+}
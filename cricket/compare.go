@@ -0,0 +1,69 @@
+package cricket
+
+import (
+	"context"
+)
+
+// ComparedVariant is one variant's results, with the rows that the other
+// variant didn't return marked in Only.
+type ComparedVariant struct {
+	Label  string
+	Result Result
+	Only   []bool
+}
+
+// ComparedResult is one projection's results for two variants of a query.
+type ComparedResult struct {
+	Header   string
+	Id       string
+	Variants []ComparedVariant
+}
+
+// markDifferences matches up identical rows in a and b, in order, and
+// returns which rows of each weren't matched.
+func markDifferences(a Result, b Result) (onlyA []bool, onlyB []bool) {
+	unmatched := make(map[string][]int)
+	onlyA = make([]bool, len(a.Rows))
+	onlyB = make([]bool, len(b.Rows))
+
+	for i, row := range a.Rows {
+		k := rowKey(row, -1)
+		unmatched[k] = append(unmatched[k], i)
+		onlyA[i] = true
+	}
+
+	for i, row := range b.Rows {
+		k := rowKey(row, -1)
+
+		if len(unmatched[k]) == 0 {
+			onlyB[i] = true
+			continue
+		}
+
+		onlyA[unmatched[k][0]] = false
+		unmatched[k] = unmatched[k][1:]
+	}
+
+	return
+}
+
+// ProjectCompare runs query as it is (variant A) and with its SQL replaced
+// by sqlB (variant B) for each projection.
+func (e *Engine) ProjectCompare(ctx context.Context, query Query, sqlB string, limit int, timeout int) (out []ComparedResult) {
+	a := e.ProjectQuery(ctx, query, limit, timeout)
+
+	query.SQL = sqlB
+	b := e.ProjectQuery(ctx, query, limit, timeout)
+
+	for i := range a {
+		onlyA, onlyB := markDifferences(a[i].Result, b[i].Result)
+
+		out = append(out, ComparedResult{
+			a[i].Header,
+			a[i].Id,
+			[]ComparedVariant{{"A", a[i].Result, onlyA}, {"B", b[i].Result, onlyB}},
+		})
+	}
+
+	return
+}
@@ -0,0 +1,30 @@
+package cricket
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestMarkDifferences(t *testing.T) {
+	cases := []struct {
+		a     [][]any
+		b     [][]any
+		onlyA []bool
+		onlyB []bool
+	}{
+		{[][]any{}, [][]any{}, []bool{}, []bool{}},
+		{[][]any{{"A", 1}, {"B", 2}}, [][]any{{"A", 1}, {"B", 2}}, []bool{false, false}, []bool{false, false}},
+		{[][]any{{"A", 1}, {"B", 2}}, [][]any{{"B", 2}, {"C", 3}}, []bool{true, false}, []bool{false, true}},
+		{[][]any{{"A", 1}, {"A", 1}}, [][]any{{"A", 1}}, []bool{false, true}, []bool{false}},
+		{[][]any{{"A", 1}}, [][]any{{"A", 2}}, []bool{true}, []bool{true}},
+	}
+
+	for _, c := range cases {
+		onlyA, onlyB := markDifferences(Result{Rows: c.a}, Result{Rows: c.b})
+
+		if diff := cmp.Diff([][]bool{c.onlyA, c.onlyB}, [][]bool{onlyA, onlyB}); diff != "" {
+			t.Errorf("markDifferences(%v, %v) mismatch (-expected +result):\n%s", c.a, c.b, diff)
+		}
+	}
+}
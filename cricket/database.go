@@ -0,0 +1,119 @@
+package cricket
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// How long the readiness checks can take in total before the database
+// counts as too slow to serve queries.
+const readinessTimeout = time.Second
+
+// Database is a handle on the innings database. A reload replaces it while
+// requests may still be using the old one, so code gets it from
+// Engine.UseDatabase rather than holding on to it.
+type Database struct {
+	*sqlx.DB
+	Path string
+
+	// Values holds things worked out from the data, like the list of
+	// teams, so that a reload drops them along with the database. Keys are
+	// up to the caller.
+	Values sync.Map
+
+	users int64
+
+	// key identifies the database to player_id(), which looks names up in
+	// players.
+	key     int64
+	players *playerDirectory
+}
+
+// Open opens the innings database read-only, so that even a statement that
+// gets past the guards can't change it.
+func Open(path string) (*Database, error) {
+	registerSQLFunctions()
+
+	db, err := sqlx.Connect("sqlite", "file:"+path+"?mode=ro&_pragma=query_only(1)")
+	if err != nil {
+		return nil, err
+	}
+
+	d := &Database{DB: db, Path: path, key: lastDatabaseKey.Add(1), players: loadPlayerDirectory(db)}
+	openDatabases.Store(d.key, d)
+
+	return d, nil
+}
+
+// MustOpen is Open, but panics if the database can't be opened.
+func MustOpen(path string) *Database {
+	d, err := Open(path)
+	if err != nil {
+		panic(err)
+	}
+
+	return d
+}
+
+// Close closes the database, after which player_id() can't find it.
+func (d *Database) Close() error {
+	openDatabases.Delete(d.key)
+
+	return d.DB.Close()
+}
+
+// drain waits up to timeout for everything using d, including connections
+// taken from it for queries, to finish, and then closes it.
+func (d *Database) drain(timeout time.Duration) {
+	deadline := time.Now().Add(timeout)
+
+	for (atomic.LoadInt64(&d.users) > 0 || d.Stats().InUse > 0) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	d.Close()
+}
+
+// Tables lists the tables that scripts/create-db builds: one for each
+// gender, format and kind of innings.
+func Tables() (out []string) {
+	for _, gender := range GenderValues {
+		for _, format := range FormatValues {
+			for _, kind := range []string{"batting", "bowling", "team"} {
+				out = append(out, fmt.Sprintf("%s_%s_%s_innings", gender.Value, format.Value, kind))
+			}
+		}
+	}
+
+	return
+}
+
+// Check returns the problems that would stop the database serving
+// queries: missing or empty tables, or being too slow to answer at all.
+func (d *Database) Check(ctx context.Context) (problems []string) {
+	ctx, cancel := context.WithTimeout(ctx, readinessTimeout)
+	defer cancel()
+
+	var one int
+
+	if err := d.GetContext(ctx, &one, "SELECT 1;"); err != nil {
+		return []string{fmt.Sprintf("trivial query failed: %v", err)}
+	}
+
+	for _, table := range Tables() {
+		var exists bool
+
+		if err := d.GetContext(ctx, &exists, fmt.Sprintf("SELECT EXISTS (SELECT 1 FROM %s);", table)); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", table, err))
+		} else if !exists {
+			problems = append(problems, fmt.Sprintf("%s: no rows", table))
+		}
+	}
+
+	return
+}
@@ -0,0 +1,108 @@
+package cricket
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func TestReloadDatabase(t *testing.T) {
+	original, done, _ := testEngine.UseDatabase(DefaultDataset)
+	done()
+
+	// The reload drains and closes the database it replaces, so that can't
+	// be the one shared by the other tests.
+	e := New(MustOpen(original.Path), testOptions())
+
+	dir := t.TempDir()
+	content, err := os.ReadFile(original.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	good := filepath.Join(dir, "innings.sqlite3")
+	os.WriteFile(good, content, 0444)
+
+	partial := filepath.Join(dir, "partial.sqlite3")
+	sqlx.MustConnect("sqlite", partial).MustExec("CREATE TABLE men_test_batting_innings (runs integer);")
+
+	cases := []struct {
+		path     string
+		expected string
+		error    string
+	}{
+		{good, good, ""},
+		{partial, good, "partial.sqlite3 is not ready: men_test_batting_innings: no rows;"},
+		{filepath.Join(dir, "missing.sqlite3"), good, "unable to open database file"},
+	}
+
+	for _, c := range cases {
+		err := e.Reload(DefaultDataset, c.path, time.Second)
+
+		if (err == nil) != (c.error == "") || (err != nil && !strings.Contains(err.Error(), c.error)) {
+			t.Errorf("reload(%q) returned error %v, want %q", c.path, err, c.error)
+		}
+
+		if path := e.databases[DefaultDataset].Load().(*Database).Path; path != c.expected {
+			t.Errorf("reload(%q) left the database as %q, want %q", c.path, path, c.expected)
+		}
+	}
+
+	if result := e.RunQuery(context.Background(), "SELECT count(*) FROM men_test_batting_innings;", 1, 100); len(result.Messages) > 0 {
+		t.Errorf("runQuery() after reload returned %v", result.Messages)
+	}
+}
+
+func TestDrain(t *testing.T) {
+	original, done, _ := testEngine.UseDatabase(DefaultDataset)
+	done()
+
+	old := MustOpen(original.Path)
+	e := New(old, testOptions())
+
+	inUse, done, _ := e.UseDatabase(DefaultDataset)
+	e.setDatabase(DefaultDataset, MustOpen(original.Path))
+
+	if inUse != old {
+		t.Fatalf("useDatabase() did not return the current database")
+	}
+
+	drained := make(chan struct{})
+
+	go func() {
+		old.drain(time.Second)
+		close(drained)
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+
+	select {
+	case <-drained:
+		t.Errorf("drain() closed the database while it was in use")
+	default:
+	}
+
+	if err := inUse.Ping(); err != nil {
+		t.Errorf("Ping() while draining returned %v", err)
+	}
+
+	done()
+	<-drained
+
+	if err := old.Ping(); err == nil {
+		t.Errorf("drain() did not close the database")
+	}
+}
+
+func TestExpectedTables(t *testing.T) {
+	tables := Tables()
+
+	if len(tables) != 18 || tables[0] != "men_test_batting_innings" || tables[17] != "women_t20i_team_innings" {
+		t.Errorf("Tables() == %v", tables)
+	}
+}
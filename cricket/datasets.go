@@ -0,0 +1,87 @@
+package cricket
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sync/atomic"
+)
+
+// The dataset that New is given, which is used when a query doesn't name
+// one.
+const DefaultDataset = "live"
+
+const datasetKey contextKey = "dataset"
+
+var matchDatasetName = regexp.MustCompile(`\A[a-z0-9][a-z0-9-]*\z`)
+
+var ErrNoDataset = errors.New("no such dataset")
+
+// Dataset is one innings database that queries can run against, such as
+// the live data or a frozen end-of-season snapshot. Date is when the data
+// was taken, for showing next to results; it's blank for data that's
+// refreshed.
+type Dataset struct {
+	Name        string `toml:"name"`
+	Path        string `toml:"path"`
+	Description string `toml:"description"`
+	Date        string `toml:"date"`
+}
+
+// Validate checks a dataset from the configuration, which can't take the
+// default dataset's name.
+func (d Dataset) Validate() error {
+	if !matchDatasetName.MatchString(d.Name) {
+		return fmt.Errorf("datasets: name must be lowercase letters, digits and dashes, not %q", d.Name)
+	}
+
+	if d.Name == DefaultDataset {
+		return fmt.Errorf("datasets: %q is the name of the dataset from database", d.Name)
+	}
+
+	if d.Path == "" {
+		return fmt.Errorf("datasets: %s: path must be set", d.Name)
+	}
+
+	return nil
+}
+
+// WithDataset makes queries run with ctx use the named dataset.
+func WithDataset(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, datasetKey, name)
+}
+
+// DatasetName returns the dataset that queries run with ctx use, which is
+// blank for the default.
+func DatasetName(ctx context.Context) string {
+	name, _ := ctx.Value(datasetKey).(string)
+
+	return name
+}
+
+// Mount adds a dataset for queries to use.
+func (e *Engine) Mount(dataset Dataset, d *Database) {
+	handle := &atomic.Value{}
+	handle.Store(d)
+
+	e.Datasets = append(e.Datasets, dataset)
+	e.databases[dataset.Name] = handle
+}
+
+// FindDataset returns the named dataset, or the default if name is blank.
+// A name that isn't mounted is an error rather than the default, so that a
+// stale link can't quietly show results from different data.
+func (e *Engine) FindDataset(name string) (Dataset, error) {
+	if name == "" {
+		return e.Datasets[0], nil
+	}
+
+	for _, dataset := range e.Datasets {
+		if dataset.Name == name {
+			return dataset, nil
+		}
+	}
+
+	return Dataset{}, fmt.Errorf("%w: %q", ErrNoDataset, name)
+}
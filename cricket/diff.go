@@ -0,0 +1,155 @@
+package cricket
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ChangedRow is a row whose key is in both results but whose other values
+// aren't, with the columns that differ marked in Changed.
+type ChangedRow struct {
+	Before  []any
+	After   []any
+	Changed []bool
+}
+
+// ResultDiff is what changed in a query's results from one dataset
+// (before) to another (after). Truncated is set when either result was cut
+// off at the row limit, as rows past it aren't compared and the diff may
+// be missing changes or show rows as added or removed when they weren't.
+type ResultDiff struct {
+	Columns   []string
+	Added     [][]any
+	Removed   [][]any
+	Changed   []ChangedRow
+	Messages  []string
+	Before    time.Duration
+	After     time.Duration
+	Truncated bool
+}
+
+type LabelledDiff struct {
+	Header string
+	Id     string
+	Diff   ResultDiff
+}
+
+// rowKey returns the value of the key column, or the whole row when there
+// isn't one.
+func rowKey(row []any, key int) string {
+	if key >= 0 {
+		return fmt.Sprint(row[key])
+	}
+
+	values := make([]string, len(row))
+	for i, value := range row {
+		values[i] = fmt.Sprint(value)
+	}
+
+	return strings.Join(values, "\x00")
+}
+
+// diffResults compares two results of the same query row by row, matching
+// rows on the key column, or on the whole row if key is blank (so a change
+// shows as one row removed and another added). Rows that share a key are
+// matched up in order.
+func diffResults(from string, before Result, to string, after Result, key string) (diff ResultDiff) {
+	diff.Before = before.Duration
+	diff.After = after.Duration
+	diff.Truncated = before.Truncated || after.Truncated
+
+	for _, message := range before.Messages {
+		diff.Messages = append(diff.Messages, fmt.Sprintf("%s: %s", from, message))
+	}
+
+	for _, message := range after.Messages {
+		diff.Messages = append(diff.Messages, fmt.Sprintf("%s: %s", to, message))
+	}
+
+	if before.Columns == nil || after.Columns == nil {
+		return
+	}
+
+	if strings.Join(before.Columns, ", ") != strings.Join(after.Columns, ", ") {
+		diff.Messages = append(diff.Messages, fmt.Sprintf("The columns are different: %s in %s, and %s in %s", strings.Join(before.Columns, ", "), from, strings.Join(after.Columns, ", "), to))
+		return
+	}
+
+	index := -1
+
+	if key != "" {
+		for i, column := range after.Columns {
+			if column == key {
+				index = i
+			}
+		}
+
+		if index < 0 {
+			diff.Messages = append(diff.Messages, fmt.Sprintf("There is no %s column to use as the key", key))
+			return
+		}
+	}
+
+	diff.Columns = after.Columns
+	unmatched := make(map[string][]int)
+	matched := make([]bool, len(before.Rows))
+
+	for i, row := range before.Rows {
+		k := rowKey(row, index)
+		unmatched[k] = append(unmatched[k], i)
+	}
+
+	for _, row := range after.Rows {
+		k := rowKey(row, index)
+
+		if len(unmatched[k]) == 0 {
+			diff.Added = append(diff.Added, row)
+			continue
+		}
+
+		i := unmatched[k][0]
+		unmatched[k] = unmatched[k][1:]
+		matched[i] = true
+
+		changed := ChangedRow{Before: before.Rows[i], After: row, Changed: make([]bool, len(row))}
+		different := false
+
+		for j := range row {
+			if fmt.Sprint(before.Rows[i][j]) != fmt.Sprint(row[j]) {
+				changed.Changed[j] = true
+				different = true
+			}
+		}
+
+		if different {
+			diff.Changed = append(diff.Changed, changed)
+		}
+	}
+
+	for i, row := range before.Rows {
+		if !matched[i] {
+			diff.Removed = append(diff.Removed, row)
+		}
+	}
+
+	return
+}
+
+// ProjectDiff runs query against the from and to datasets, and compares
+// the results for each projection.
+func (e *Engine) ProjectDiff(ctx context.Context, query Query, from string, to string, key string, limit int, timeout int) (out []LabelledDiff) {
+	before := e.ProjectQuery(WithDataset(ctx, from), query, limit, timeout)
+	after := e.ProjectQuery(WithDataset(ctx, to), query, limit, timeout)
+
+	for i := range after {
+		out = append(out, LabelledDiff{
+			after[i].Header,
+			after[i].Id,
+			diffResults(from, before[i].Result, to, after[i].Result, key),
+		})
+	}
+
+	return
+}
@@ -0,0 +1,99 @@
+package cricket
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDiffResults(t *testing.T) {
+	columns := []string{"player", "runs"}
+	before := Result{
+		Columns:  columns,
+		Rows:     [][]any{{"A", int64(10)}, {"B", int64(20)}, {"C", int64(30)}, {"C", int64(31)}},
+		Duration: time.Second,
+	}
+	after := Result{
+		Columns:  columns,
+		Rows:     [][]any{{"A", int64(10)}, {"B", int64(25)}, {"C", int64(30)}, {"D", int64(40)}},
+		Duration: 2 * time.Second,
+	}
+
+	cases := []struct {
+		before   Result
+		after    Result
+		key      string
+		expected ResultDiff
+	}{
+		{
+			before,
+			after,
+			"player",
+			ResultDiff{
+				Columns: columns,
+				Added:   [][]any{{"D", int64(40)}},
+				Removed: [][]any{{"C", int64(31)}},
+				Changed: []ChangedRow{{[]any{"B", int64(20)}, []any{"B", int64(25)}, []bool{false, true}}},
+				Before:  time.Second,
+				After:   2 * time.Second,
+			},
+		},
+		{
+			before,
+			after,
+			"",
+			ResultDiff{
+				Columns: columns,
+				Added:   [][]any{{"B", int64(25)}, {"D", int64(40)}},
+				Removed: [][]any{{"B", int64(20)}, {"C", int64(31)}},
+				Before:  time.Second,
+				After:   2 * time.Second,
+			},
+		},
+		{
+			before,
+			before,
+			"player",
+			ResultDiff{Columns: columns, Before: time.Second, After: time.Second},
+		},
+		{
+			before,
+			after,
+			"team",
+			ResultDiff{Messages: []string{"There is no team column to use as the key"}, Before: time.Second, After: 2 * time.Second},
+		},
+		{
+			before,
+			Result{Columns: []string{"player"}, Rows: [][]any{{"A"}}},
+			"",
+			ResultDiff{Messages: []string{"The columns are different: player, runs in old, and player in new"}, Before: time.Second},
+		},
+		{
+			before,
+			Result{Columns: columns, Rows: after.Rows[:2], Truncated: true},
+			"player",
+			ResultDiff{
+				Columns:   columns,
+				Removed:   [][]any{{"C", int64(30)}, {"C", int64(31)}},
+				Changed:   []ChangedRow{{[]any{"B", int64(20)}, []any{"B", int64(25)}, []bool{false, true}}},
+				Before:    time.Second,
+				Truncated: true,
+			},
+		},
+		{
+			Result{Messages: []string{"no such table: x"}},
+			after,
+			"",
+			ResultDiff{Messages: []string{"old: no such table: x"}, After: 2 * time.Second},
+		},
+	}
+
+	for _, c := range cases {
+		result := diffResults("old", c.before, "new", c.after, c.key)
+
+		if diff := cmp.Diff(c.expected, result); diff != "" {
+			t.Errorf("diffResults(%v, %v, %q) mismatch (-expected +result):\n%s", c.before, c.after, c.key, diff)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+// Package cricket runs SQL against the innings databases that
+// scripts/create-db builds, once for each gender and format, with the
+// limits and guards that make it safe to take queries from anyone. It knows
+// nothing about HTTP; cricket-query serves it, and other programs can embed
+// it.
+package cricket
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	sqlite3 "modernc.org/sqlite"
+)
+
+// Engine runs queries against the innings databases. It owns a handle for
+// each dataset, which a reload can replace, the limits on queries, and the
+// saved queries.
+type Engine struct {
+	Datasets     []Dataset
+	Limiter      *Limiter
+	databases    map[string]*atomic.Value
+	sqliteLimits []sqliteLimit
+
+	RowsLimit     int
+	DiffRowsLimit int
+	Timeout       int
+	RedactSQL     bool
+	SavedQueries  map[string]Query
+
+	// Logger gets a line for every query. Observe, if set, is called with
+	// every query's result, for metrics.
+	Logger  *slog.Logger
+	Observe func(projection string, result Result)
+
+	active    atomic.Int64
+	cancelled atomic.Int64
+}
+
+// Options are the settings for a new Engine. Timeouts are in milliseconds,
+// and RateLimit is per minute.
+type Options struct {
+	RowsLimit     int
+	DiffRowsLimit int
+	Timeout       int
+	RedactSQL     bool
+	SavedQueries  map[string]Query
+
+	MaxQueries   int
+	QueueTimeout int
+	RateLimit    int
+	RateBurst    int
+
+	// A nil Logger discards the query log.
+	Logger  *slog.Logger
+	Observe func(projection string, result Result)
+}
+
+var registerFunctions sync.Once
+
+// registerSQLFunctions adds our functions to the SQLite driver. They're only
+// available on connections opened afterwards, so this has to happen before
+// any database is opened.
+func registerSQLFunctions() {
+	registerFunctions.Do(func() {
+		sqlite3.MustRegisterFunction("median", &sqlite3.FunctionImpl{
+			NArgs:         1,
+			Deterministic: true,
+			MakeAggregate: func(ctx sqlite3.FunctionContext) (sqlite3.AggregateFunction, error) {
+				return &medianFunction{}, nil
+			},
+		})
+		sqlite3.MustRegisterScalarFunction("player_id", 2, playerIdFunction)
+	})
+}
+
+// New returns an engine with d as the default dataset. Others can be added
+// with Mount.
+func New(d *Database, o Options) *Engine {
+	e := &Engine{
+		Limiter:       NewLimiter(o.MaxQueries, milliseconds(o.QueueTimeout), o.RateLimit, o.RateBurst),
+		databases:     make(map[string]*atomic.Value),
+		sqliteLimits:  defaultSQLiteLimits,
+		RowsLimit:     o.RowsLimit,
+		DiffRowsLimit: o.DiffRowsLimit,
+		Timeout:       o.Timeout,
+		RedactSQL:     o.RedactSQL,
+		SavedQueries:  o.SavedQueries,
+		Logger:        o.Logger,
+		Observe:       o.Observe,
+	}
+
+	if e.Logger == nil {
+		e.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+
+	e.Mount(Dataset{Name: DefaultDataset, Path: d.Path, Description: "The latest data"}, d)
+
+	return e
+}
+
+// setDatabase makes d the database for new queries against the named
+// dataset, returning the one it replaced.
+func (e *Engine) setDatabase(name string, d *Database) *Database {
+	handle := e.databases[name]
+	old := handle.Load().(*Database)
+	handle.Store(d)
+
+	return old
+}
+
+// UseDatabase returns the current database for the named dataset (or the
+// default, if name is blank) and a function to call when done with it. A
+// handle that is swapped out between loading and counting it is given back,
+// and the new one used instead, so that a reload never closes a handle that
+// something is about to use.
+func (e *Engine) UseDatabase(name string) (*Database, func(), error) {
+	dataset, err := e.FindDataset(name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	handle := e.databases[dataset.Name]
+
+	for {
+		d := handle.Load().(*Database)
+		atomic.AddInt64(&d.users, 1)
+
+		if handle.Load().(*Database) == d {
+			return d, func() { atomic.AddInt64(&d.users, -1) }, nil
+		}
+
+		atomic.AddInt64(&d.users, -1)
+	}
+}
+
+// Reload opens the database at path and, if it passes the same checks as
+// /readyz, swaps it in for the named dataset. The old handle is drained and
+// closed in the background, so queries running on it finish against the old
+// data.
+func (e *Engine) Reload(name string, path string, drain time.Duration) error {
+	if _, ok := e.databases[name]; !ok {
+		return fmt.Errorf("%w: %q", ErrNoDataset, name)
+	}
+
+	d, err := Open(path)
+	if err != nil {
+		return err
+	}
+
+	if problems := d.Check(context.Background()); len(problems) > 0 {
+		d.Close()
+		return fmt.Errorf("%s is not ready: %s", path, strings.Join(problems, "; "))
+	}
+
+	go e.setDatabase(name, d).drain(drain)
+
+	return nil
+}
+
+func milliseconds(n int) time.Duration {
+	return time.Duration(n) * time.Millisecond
+}
+
+func inArray(needle string, haystack []string) bool {
+	for _, value := range haystack {
+		if value == needle {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,77 @@
+package cricket
+
+import (
+	"database/sql/driver"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/jmoiron/sqlx"
+	sqlite3 "modernc.org/sqlite"
+)
+
+func init() {
+	sqlite3.MustRegisterScalarFunction(
+		"test_sleep_150",
+		0,
+		func(ctx *sqlite3.FunctionContext, args []driver.Value) (driver.Value, error) {
+			time.Sleep(150 * time.Millisecond)
+
+			return int64(1), nil
+		},
+	)
+}
+
+var ignoreDuration = cmpopts.IgnoreFields(Result{}, "Duration")
+
+func makeSingleRow(val any) [][]any {
+	rows := make([][]any, 1)
+	rows[0] = make([]any, 1)
+	rows[0][0] = val
+
+	return rows
+}
+
+var testEngine *Engine
+
+// testOptions are cricket-query's default settings.
+func testOptions() Options {
+	return Options{
+		RowsLimit:     100,
+		DiffRowsLimit: 1000,
+		Timeout:       5000,
+		MaxQueries:    8,
+		QueueTimeout:  2000,
+		RateLimit:     120,
+		RateBurst:     30,
+	}
+}
+
+// snapshotEngine has the test data as the live dataset, and a copy without
+// any fifties as "snapshot".
+func snapshotEngine(t *testing.T) *Engine {
+	live, done, _ := testEngine.UseDatabase(DefaultDataset)
+	done()
+
+	content, err := os.ReadFile(live.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "snapshot.sqlite3")
+	os.WriteFile(path, content, 0644)
+	sqlx.MustConnect("sqlite", path).MustExec("DELETE FROM men_test_batting_innings WHERE runs >= 50;")
+
+	e := New(live, testOptions())
+	e.Mount(Dataset{Name: "snapshot", Path: path, Description: "Under fifty", Date: "2023-09-30"}, MustOpen(path))
+
+	return e
+}
+
+func TestMain(m *testing.M) {
+	testEngine = New(MustOpen("../testdata/innings.sqlite3"), testOptions())
+
+	os.Exit(m.Run())
+}
@@ -0,0 +1,189 @@
+package cricket
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+var matchFullScan = regexp.MustCompile(`\ASCAN (\w+)\z`)
+var matchBigTable = regexp.MustCompile(`_(batting|bowling)_innings\z`)
+
+type PlanNode struct {
+	Id       int64
+	Parent   int64
+	Detail   string
+	Hint     string
+	Children []*PlanNode
+}
+
+type LabelledPlan struct {
+	Header   string
+	Id       string
+	Plan     []*PlanNode
+	Messages []string
+}
+
+type TableIndex struct {
+	Name    string
+	Columns []string
+}
+
+// tableIndexes lists the indexes on a table with their columns, so that
+// scan hints can suggest one that already exists.
+func (e *Engine) tableIndexes(ctx context.Context, table string) (out []TableIndex, err error) {
+	var names []string
+
+	db, done, err := e.UseDatabase(DatasetName(ctx))
+	if err != nil {
+		return
+	}
+	defer done()
+
+	err = db.SelectContext(ctx, &names, "SELECT name FROM pragma_index_list(?) ORDER BY name;", table)
+	if err != nil {
+		return
+	}
+
+	for _, name := range names {
+		var columns []string
+
+		err = db.SelectContext(ctx, &columns, "SELECT name FROM pragma_index_info(?) ORDER BY seqno;", name)
+		if err != nil {
+			return
+		}
+
+		out = append(out, TableIndex{name, columns})
+	}
+
+	return
+}
+
+// sqlWords splits a query into the words an identifier could be, so that
+// `innings.player_id=` has player_id in it.
+func sqlWords(sql string) []string {
+	return strings.FieldsFunc(sql, func(r rune) bool {
+		return r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// mentions returns whether any of the words is the identifier, ignoring
+// case as SQLite does.
+func mentions(words []string, identifier string) bool {
+	for _, word := range words {
+		if strings.EqualFold(word, identifier) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// scanHint explains a full-table scan of one of the big innings tables,
+// suggesting an existing index if the query mentions its leading column.
+func (e *Engine) scanHint(ctx context.Context, table string, sql string) string {
+	hint := fmt.Sprintf("Full scan of %s, which reads every row.", table)
+	indexes, err := e.tableIndexes(ctx, table)
+
+	if err != nil {
+		return hint
+	}
+
+	words := sqlWords(sql)
+
+	for _, index := range indexes {
+		if len(index.Columns) == 0 {
+			continue
+		}
+
+		if mentions(words, index.Columns[0]) {
+			return fmt.Sprintf("%s The query mentions %s: filtering or joining on it directly (not through a function or expression) would let SQLite use the %s index.", hint, index.Columns[0], index.Name)
+		}
+	}
+
+	if len(indexes) == 0 {
+		return hint + " There are no indexes on this table."
+	}
+
+	columns := make([]string, 0, len(indexes))
+	for _, index := range indexes {
+		if len(index.Columns) > 0 && !inArray(index.Columns[0], columns) {
+			columns = append(columns, index.Columns[0])
+		}
+	}
+
+	return fmt.Sprintf("%s Filtering or joining on an indexed column (%s) would avoid this.", hint, strings.Join(columns, ", "))
+}
+
+func (e *Engine) explainQuery(ctx context.Context, sql string, timeout int) ([]*PlanNode, error) {
+	var rows []struct {
+		Id      int64  `db:"id"`
+		Parent  int64  `db:"parent"`
+		Notused int64  `db:"notused"`
+		Detail  string `db:"detail"`
+	}
+	roots := make([]*PlanNode, 0)
+	nodes := make(map[int64]*PlanNode)
+
+	ctx, cancel := context.WithTimeout(ctx, milliseconds(timeout))
+	defer cancel()
+
+	conn, bound, err := e.guardedConn(ctx, sql)
+	if err != nil {
+		return nil, err
+	}
+
+	err = conn.SelectContext(ctx, &rows, "EXPLAIN QUERY PLAN "+bound)
+	closeConn(conn, err != nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		node := &PlanNode{Id: row.Id, Parent: row.Parent, Detail: row.Detail}
+
+		if match := matchFullScan.FindStringSubmatch(row.Detail); match != nil && matchBigTable.MatchString(match[1]) {
+			node.Hint = e.scanHint(ctx, match[1], sql)
+		}
+
+		nodes[row.Id] = node
+
+		if parent, ok := nodes[row.Parent]; ok {
+			parent.Children = append(parent.Children, node)
+		} else {
+			roots = append(roots, node)
+		}
+	}
+
+	return roots, nil
+}
+
+// ProjectExplain returns the query plan for each of query's checked
+// formats and genders, with hints for slow scans.
+func (e *Engine) ProjectExplain(ctx context.Context, query Query, timeout int) (out []LabelledPlan) {
+	for _, format := range query.Formats {
+		for _, gender := range query.Genders {
+			if format.Checked && gender.Checked {
+				plan := LabelledPlan{
+					Header: fmt.Sprintf("%s's %s", gender.Label, format.Label),
+					Id:     fmt.Sprintf("%s-%s", gender.Value, format.Value),
+				}
+
+				nodes, err := e.explainQuery(ctx, AddAliases(gender.Value, format.Value, query.SQL), timeout)
+
+				if err != nil {
+					plan.Messages = []string{err.Error()}
+				} else {
+					plan.Plan = nodes
+				}
+
+				out = append(out, plan)
+			}
+		}
+	}
+
+	return
+}
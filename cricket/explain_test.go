@@ -0,0 +1,109 @@
+package cricket
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestMentions(t *testing.T) {
+	cases := []struct {
+		sql        string
+		identifier string
+		expected   bool
+	}{
+		{"SELECT * FROM innings WHERE player_id = 'p1'", "player_id", true},
+		{"SELECT * FROM innings WHERE innings.PLAYER_ID='p1'", "player_id", true},
+		{"SELECT * FROM innings WHERE player_idx = 'p1'", "player_id", false},
+		{"SELECT * FROM innings WHERE player = 'p1'", "player_id", false},
+		{"SELECT * FROM innings WHERE lower(match_id) = 'm1'", "match_id", true},
+	}
+
+	for _, c := range cases {
+		if result := mentions(sqlWords(c.sql), c.identifier); result != c.expected {
+			t.Errorf("mentions(sqlWords(%q), %q) == %v, want %v", c.sql, c.identifier, result, c.expected)
+		}
+	}
+}
+
+func TestExplainQuery(t *testing.T) {
+	ctx := context.Background()
+
+	cases := []struct {
+		sql     string
+		details []string
+		hint    string
+	}{
+		{
+			// The test data is small enough that SQLite would rather scan.
+			"SELECT * FROM men_test_batting_innings INDEXED BY men_test_batting_innings_match_id WHERE match_id = 'm1';",
+			[]string{"SEARCH men_test_batting_innings USING INDEX men_test_batting_innings_match_id (match_id=?)"},
+			"",
+		},
+		{
+			"SELECT * FROM men_test_batting_innings WHERE lower(match_id) = 'm1';",
+			[]string{"SCAN men_test_batting_innings"},
+			"would let SQLite use the men_test_batting_innings_match_id index",
+		},
+		{
+			"SELECT * FROM men_test_bowling_innings WHERE player = 'A Shaw';",
+			[]string{"SCAN men_test_bowling_innings"},
+			"Filtering or joining on an indexed column (match_id, player_id, start_date, team) would avoid this.",
+		},
+		{
+			"SELECT * FROM men_test_team_innings;",
+			[]string{"SCAN men_test_team_innings"},
+			"",
+		},
+	}
+
+	for _, c := range cases {
+		plan, err := testEngine.explainQuery(ctx, c.sql, 100)
+
+		if err != nil {
+			t.Fatalf("explainQuery(ctx, %q, 100) returned error: %v", c.sql, err)
+		}
+
+		details := make([]string, 0)
+		for _, node := range plan {
+			details = append(details, node.Detail)
+		}
+
+		if strings.Join(details, "\n") != strings.Join(c.details, "\n") {
+			t.Errorf("explainQuery(ctx, %q, 100) == %v, want %v", c.sql, details, c.details)
+		}
+
+		if hint := plan[0].Hint; (c.hint == "" && hint != "") || !strings.Contains(hint, c.hint) {
+			t.Errorf("explainQuery(ctx, %q, 100) hint == %q, want %q", c.sql, hint, c.hint)
+		}
+	}
+}
+
+func TestExplainQueryTree(t *testing.T) {
+	plan, err := testEngine.explainQuery(context.Background(), "SELECT * FROM men_test_team_innings WHERE runs > (SELECT AVG(runs) FROM men_test_team_innings);", 100)
+
+	if err != nil {
+		t.Fatalf("explainQuery() returned error: %v", err)
+	}
+
+	if len(plan) != 2 || len(plan[1].Children) != 1 || plan[1].Children[0].Detail != "SCAN men_test_team_innings" {
+		t.Errorf("explainQuery() == %v", plan)
+	}
+}
+
+func TestProjectExplain(t *testing.T) {
+	query := Query{
+		SQL:     "SELECT * FROM innings WHERE;",
+		Formats: CheckboxValues(FormatValues, []string{"test", "odi"}),
+		Genders: CheckboxValues(GenderValues, []string{"women"}),
+	}
+	plans := testEngine.ProjectExplain(context.Background(), query, 100)
+
+	if len(plans) != 2 || plans[0].Id != "women-test" || plans[1].Header != "Women's ODI" {
+		t.Fatalf("projectExplain(ctx, %v, 100) == %v", query, plans)
+	}
+
+	if len(plans[0].Messages) != 1 || plans[0].Plan != nil {
+		t.Errorf("projectExplain(ctx, %v, 100) == %v, want a syntax error", query, plans)
+	}
+}
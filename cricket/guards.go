@@ -0,0 +1,95 @@
+package cricket
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"modernc.org/sqlite"
+	sqlitelib "modernc.org/sqlite/lib"
+)
+
+// Limits on what a single statement can do, on top of the query timeout.
+// The views in the schema count towards the length limits too, so these
+// can't be much lower.
+type sqliteLimit struct {
+	id    int
+	value int
+}
+
+var defaultSQLiteLimits = []sqliteLimit{
+	// Strings and blobs, including results like randomblob(1e9).
+	{sqlitelib.SQLITE_LIMIT_LENGTH, 1000000},
+	{sqlitelib.SQLITE_LIMIT_SQL_LENGTH, 100000},
+	// ATTACH could otherwise open (or create) any file we can see.
+	{sqlitelib.SQLITE_LIMIT_ATTACHED, 0},
+	{sqlitelib.SQLITE_LIMIT_COMPOUND_SELECT, 50},
+	// The size of the compiled statement; the saved queries use a few
+	// hundred instructions.
+	{sqlitelib.SQLITE_LIMIT_VDBE_OP, 25000},
+}
+
+// The driver has no authorizer callback, so statements that could undo the
+// other guards are found by keyword instead. load_extension is already
+// refused by the driver.
+var matchDeniedStatement = regexp.MustCompile(`(?i)\b(ATTACH|DETACH|PRAGMA|VACUUM)\b`)
+
+// Literals, quoted identifiers and comments, which can mention the denied
+// keywords harmlessly.
+var matchQuoted = regexp.MustCompile(`(?s)'(?:[^']|'')*'|"(?:[^"]|"")*"|` + "`(?:[^`]|``)*`" + `|\[[^\]]*\]|--[^\n]*|/\*.*?(?:\*/|\z)`)
+
+// checkStatement rejects SQL that uses the denied statements. The driver
+// runs every statement in a query, so they're looked for anywhere, not just
+// at the start.
+func checkStatement(sql string) error {
+	if match := matchDeniedStatement.FindString(matchQuoted.ReplaceAllString(sql, " ")); match != "" {
+		return fmt.Errorf("%s statements are not allowed", strings.ToUpper(match))
+	}
+
+	return nil
+}
+
+// guardedConn checks the SQL and returns a connection with the limits
+// applied, along with the SQL to run on it. Limits belong to a connection
+// rather than the pool, so they're set every time; it's cheap.
+func (e *Engine) guardedConn(ctx context.Context, sql string) (*sqlx.Conn, string, error) {
+	if err := checkStatement(sql); err != nil {
+		return nil, "", err
+	}
+
+	db, done, err := e.UseDatabase(DatasetName(ctx))
+	if err != nil {
+		return nil, "", err
+	}
+
+	conn, err := db.Connx(ctx)
+	done()
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	for _, limit := range e.sqliteLimits {
+		if _, err := sqlite.Limit(conn.Conn, limit.id, limit.value); err != nil {
+			conn.Close()
+			return nil, "", err
+		}
+	}
+
+	return conn, db.bindPlayerIds(sql), nil
+}
+
+// closeConn returns conn to the pool, or closes it for good if its query
+// failed. After some errors the driver leaves a statement unfinished, and
+// SQLite keeps an interrupt in effect until every statement on the
+// connection finishes, so every later query on it would be interrupted too.
+func closeConn(conn *sqlx.Conn, failed bool) {
+	if failed {
+		conn.Raw(func(any) error { return driver.ErrBadConn })
+	}
+
+	conn.Close()
+}
@@ -0,0 +1,33 @@
+package cricket
+
+import (
+	"testing"
+)
+
+func TestCheckStatement(t *testing.T) {
+	cases := []struct {
+		sql      string
+		expected string
+	}{
+		{"SELECT * FROM innings;", ""},
+		{"SELECT * FROM pragma_table_info('innings');", ""},
+		{"SELECT 'PRAGMA query_only = 0' AS pragma_text;", ""},
+		{`SELECT 1 AS "attach";`, ""},
+		{"SELECT 1 -- VACUUM INTO 'copy.sqlite3'\n;", ""},
+		{"SELECT 1 /* DETACH main */;", ""},
+		{"PRAGMA query_only = 0;", "PRAGMA statements are not allowed"},
+		{"pragma query_only = 0;", "PRAGMA statements are not allowed"},
+		{"SELECT 1; /* comment */ pragma query_only = 0;", "PRAGMA statements are not allowed"},
+		{"SELECT 'it''s'; ATTACH 'other.sqlite3' AS other;", "ATTACH statements are not allowed"},
+		{"DETACH main;", "DETACH statements are not allowed"},
+		{"VACUUM INTO '/tmp/copy.sqlite3';", "VACUUM statements are not allowed"},
+	}
+
+	for _, c := range cases {
+		err := checkStatement(c.sql)
+
+		if (err == nil && c.expected != "") || (err != nil && err.Error() != c.expected) {
+			t.Errorf("checkStatement(%q) == %v, want %q", c.sql, err, c.expected)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package cricket
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+type contextKey string
+
+const clientKey contextKey = "client"
+const chargeKey contextKey = "charge"
+
+// These are returned as query messages, which callers can word for people.
+var ErrServerBusy = errors.New("server busy")
+var ErrRateLimited = errors.New("rate limited")
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Limiter caps the number of queries running at once across all clients,
+// with a short queue for the rest, and rate limits each client with a token
+// bucket: every request that runs queries takes a token, however many it
+// runs, and tokens refill at a steady rate up to a burst size.
+type Limiter struct {
+	slots        chan struct{}
+	queueTimeout time.Duration
+	rate         float64
+	burst        float64
+
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+// NewLimiter allows maxQueries at once, and perMinute requests from each
+// client, in bursts of up to burst. A perMinute of 0 turns off the rate
+// limit.
+func NewLimiter(maxQueries int, queueTimeout time.Duration, perMinute int, burst int) *Limiter {
+	return &Limiter{
+		slots:        make(chan struct{}, maxQueries),
+		queueTimeout: queueTimeout,
+		rate:         float64(perMinute) / 60,
+		burst:        float64(burst),
+		buckets:      make(map[string]*tokenBucket),
+	}
+}
+
+// allow takes a token from the client's bucket, if there is one.
+func (l *Limiter) allow(client string, now time.Time) bool {
+	if l.rate <= 0 || client == "" {
+		return true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// Buckets that would have refilled completely are the same as new ones,
+	// so there's no need to keep them around.
+	if now.Sub(l.lastSweep) > time.Minute {
+		for key, bucket := range l.buckets {
+			if bucket.tokens+now.Sub(bucket.last).Seconds()*l.rate >= l.burst {
+				delete(l.buckets, key)
+			}
+		}
+
+		l.lastSweep = now
+	}
+
+	bucket, ok := l.buckets[client]
+
+	if !ok {
+		bucket = &tokenBucket{l.burst, now}
+		l.buckets[client] = bucket
+	}
+
+	bucket.tokens += now.Sub(bucket.last).Seconds() * l.rate
+	bucket.last = now
+
+	if bucket.tokens > l.burst {
+		bucket.tokens = l.burst
+	}
+
+	if bucket.tokens < 1 {
+		return false
+	}
+
+	bucket.tokens -= 1
+
+	return true
+}
+
+// requestCharge is a request's token: it's taken with the request's first
+// query, and the result reused for the rest.
+type requestCharge struct {
+	once    sync.Once
+	allowed bool
+}
+
+// WithClient records who queries run with ctx are for, for the rate limit,
+// and gives them a single charge against it, so that a request that runs a
+// query for each projection costs the same as one that runs a single
+// query.
+func WithClient(ctx context.Context, client string) context.Context {
+	ctx = context.WithValue(ctx, clientKey, client)
+
+	return context.WithValue(ctx, chargeKey, &requestCharge{})
+}
+
+// Client returns the client that WithClient recorded.
+func Client(ctx context.Context) string {
+	client, _ := ctx.Value(clientKey).(string)
+
+	return client
+}
+
+// charge takes a token for the request in ctx, if it hasn't already had
+// one. Queries outside a request, like the data-quality report, are only
+// charged if they have a client.
+func (l *Limiter) charge(ctx context.Context) bool {
+	client := Client(ctx)
+	c, ok := ctx.Value(chargeKey).(*requestCharge)
+
+	if !ok {
+		return l.allow(client, time.Now())
+	}
+
+	c.once.Do(func() { c.allowed = l.allow(client, time.Now()) })
+
+	return c.allowed
+}
+
+// Acquire waits for a query slot, returning a function to release it. It
+// gives up after the queue timeout, or if the client is over their rate
+// limit.
+func (l *Limiter) Acquire(ctx context.Context) (func(), error) {
+	if !l.charge(ctx) {
+		return nil, ErrRateLimited
+	}
+
+	release := func() { <-l.slots }
+
+	select {
+	case l.slots <- struct{}{}:
+		return release, nil
+	default:
+	}
+
+	timer := time.NewTimer(l.queueTimeout)
+	defer timer.Stop()
+
+	select {
+	case l.slots <- struct{}{}:
+		return release, nil
+	case <-timer.C:
+		return nil, ErrServerBusy
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,109 @@
+package cricket
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLimiterAllow(t *testing.T) {
+	l := NewLimiter(8, time.Second, 60, 2)
+	now := time.Now()
+
+	cases := []struct {
+		client   string
+		offset   time.Duration
+		expected bool
+	}{
+		{"192.0.2.1", 0, true},
+		{"192.0.2.1", 0, true},
+		{"192.0.2.1", 0, false},
+		{"192.0.2.2", 0, true},
+		{"192.0.2.1", 500 * time.Millisecond, false},
+		{"192.0.2.1", time.Second, true},
+		{"192.0.2.1", time.Second, false},
+		{"192.0.2.1", time.Hour, true},
+		{"192.0.2.1", time.Hour, true},
+		{"192.0.2.1", time.Hour, false},
+		{"", time.Hour, true},
+	}
+
+	for _, c := range cases {
+		if l.allow(c.client, now.Add(c.offset)) != c.expected {
+			t.Errorf("allow(%q, now + %s) == %v, want %v", c.client, c.offset, !c.expected, c.expected)
+		}
+	}
+
+	if len(l.buckets) != 1 {
+		t.Errorf("allow() kept %d buckets, want 1", len(l.buckets))
+	}
+}
+
+func TestLimiterAcquire(t *testing.T) {
+	l := NewLimiter(1, 10*time.Millisecond, 120, 30)
+	ctx := context.Background()
+
+	release, err := l.Acquire(ctx)
+	if err != nil {
+		t.Fatalf("acquire() returned error: %v", err)
+	}
+
+	if _, err := l.Acquire(ctx); err != ErrServerBusy {
+		t.Errorf("acquire() returned %v, want %v", err, ErrServerBusy)
+	}
+
+	go func() {
+		time.Sleep(time.Millisecond)
+		release()
+	}()
+
+	if release, err := l.Acquire(ctx); err != nil {
+		t.Errorf("acquire() after release returned error: %v", err)
+	} else {
+		release()
+	}
+
+	l = NewLimiter(1, 10*time.Millisecond, 120, 1)
+	ctx = context.WithValue(ctx, clientKey, "192.0.2.1")
+	release, _ = l.Acquire(ctx)
+	release()
+
+	if _, err := l.Acquire(ctx); err != ErrRateLimited {
+		t.Errorf("acquire() returned %v, want %v", err, ErrRateLimited)
+	}
+}
+
+func TestLimiterCharge(t *testing.T) {
+	l := NewLimiter(8, time.Second, 120, 2)
+	client := context.WithValue(context.Background(), clientKey, "192.0.2.1")
+
+	// Each request takes one token, however many queries it runs.
+	for request := 1; request <= 3; request++ {
+		ctx := context.WithValue(client, chargeKey, &requestCharge{})
+
+		for query := 0; query < 6; query++ {
+			if allowed := l.charge(ctx); allowed != (request <= 2) {
+				t.Errorf("charge() for query %d of request %d == %v", query, request, allowed)
+			}
+		}
+	}
+}
+
+func TestRunQueryBusy(t *testing.T) {
+	db, done, _ := testEngine.UseDatabase(DefaultDataset)
+	defer done()
+
+	o := testOptions()
+	o.MaxQueries = 1
+	o.QueueTimeout = 10
+	e := New(db, o)
+
+	release, _ := e.Limiter.Acquire(context.Background())
+	defer release()
+
+	result := e.RunQuery(context.Background(), "SELECT 1;", 1, 100)
+
+	if len(result.Messages) != 1 || result.Messages[0] != ErrServerBusy.Error() || result.Columns != nil {
+		t.Errorf("runQuery() with no free slots == %v", result)
+	}
+}
@@ -0,0 +1,70 @@
+package cricket
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+const requestIDKey contextKey = "requestID"
+const savedQueryKey contextKey = "savedQuery"
+
+// WithRequestID tags the queries run with ctx with a request's ID in the
+// log.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// RequestID returns the ID that WithRequestID recorded.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+
+	return id
+}
+
+// WithSavedQuery tags the queries run with ctx with the saved query they
+// came from in the log.
+func WithSavedQuery(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, savedQueryKey, name)
+}
+
+// sqlHash identifies a query in the logs without including its text, so
+// that runs of the same query can be grouped even with RedactSQL set.
+func sqlHash(sql string) string {
+	sum := sha256.Sum256([]byte(sql))
+
+	return hex.EncodeToString(sum[:6])
+}
+
+// logQuery logs the outcome of running sql for a projection.
+func (e *Engine) logQuery(ctx context.Context, projection string, sql string, result Result) {
+	savedQuery, _ := ctx.Value(savedQueryKey).(string)
+	errorClass := ""
+	dataset := DatasetName(ctx)
+
+	if dataset == "" {
+		dataset = DefaultDataset
+	}
+
+	if len(result.Rows) == 0 && len(result.Messages) > 0 {
+		errorClass = ErrorType(result.Messages[0])
+	}
+
+	fields := []any{
+		"request_id", RequestID(ctx),
+		"dataset", dataset,
+		"projection", projection,
+		"sql_hash", sqlHash(sql),
+		"saved_query", savedQuery,
+		"duration_ms", result.Duration.Milliseconds(),
+		"rows", len(result.Rows),
+		"truncated", result.Truncated,
+		"error", errorClass,
+	}
+
+	if !e.RedactSQL {
+		fields = append(fields, "sql", sql)
+	}
+
+	e.Logger.Info("query", fields...)
+}
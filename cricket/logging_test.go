@@ -0,0 +1,38 @@
+package cricket
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLogQuery(t *testing.T) {
+	db, done, _ := testEngine.UseDatabase(DefaultDataset)
+	defer done()
+
+	ctx := WithSavedQuery(WithRequestID(context.Background(), "abc"), "most-runs")
+	result := Result{Messages: []string{"interrupted (9)"}, Duration: 150 * time.Millisecond}
+
+	for _, redact := range []bool{false, true} {
+		var out bytes.Buffer
+
+		o := testOptions()
+		o.RedactSQL = redact
+		o.Logger = slog.New(slog.NewJSONHandler(&out, nil))
+		e := New(db, o)
+		e.logQuery(ctx, "men-test", "SELECT 1;", result)
+
+		for _, field := range []string{`"request_id":"abc"`, `"dataset":"live"`, `"projection":"men-test"`, `"sql_hash":"` + sqlHash("SELECT 1;") + `"`, `"saved_query":"most-runs"`, `"duration_ms":150`, `"rows":0`, `"error":"timeout"`} {
+			if !strings.Contains(out.String(), field) {
+				t.Errorf("logQuery() with RedactSQL = %v wrote %s, missing %s", redact, out.String(), field)
+			}
+		}
+
+		if strings.Contains(out.String(), "SELECT 1;") == redact {
+			t.Errorf("logQuery() with RedactSQL = %v wrote %s", redact, out.String())
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package cricket
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+// ErrorType groups query error messages, which include details like table
+// names, into a few types that are useful to alert on.
+func ErrorType(message string) string {
+	switch {
+	case message == "interrupted (9)" || message == "context deadline exceeded":
+		return "timeout"
+	case message == "context canceled":
+		return "cancelled"
+	case message == ErrServerBusy.Error():
+		return "busy"
+	case message == ErrRateLimited.Error():
+		return "rate_limited"
+	case strings.HasSuffix(message, "statements are not allowed"):
+		return "denied"
+	case strings.HasSuffix(message, "(7)") || strings.HasSuffix(message, "(18)") || strings.Contains(message, "too many terms"):
+		return "limit"
+	default:
+		return "sql"
+	}
+}
+
+func (e *Engine) observe(projection string, result Result) {
+	if e.Observe != nil {
+		e.Observe(projection, result)
+	}
+}
+
+// trackQuery counts a query as running until the returned function is
+// called. A query whose context was cancelled, rather than timing out, is
+// counted as cancelled; during shutdown that's because we gave up waiting.
+func (e *Engine) trackQuery(ctx context.Context) func() {
+	e.active.Add(1)
+
+	return func() {
+		if errors.Is(ctx.Err(), context.Canceled) {
+			e.cancelled.Add(1)
+		}
+
+		e.active.Add(-1)
+	}
+}
+
+// ActiveQueries returns how many queries are running now.
+func (e *Engine) ActiveQueries() int64 {
+	return e.active.Load()
+}
+
+// CancelledQueries returns how many queries have been cancelled before
+// finishing.
+func (e *Engine) CancelledQueries() int64 {
+	return e.cancelled.Load()
+}
@@ -0,0 +1,59 @@
+package cricket
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestErrorType(t *testing.T) {
+	cases := []struct {
+		message  string
+		expected string
+	}{
+		{"interrupted (9)", "timeout"},
+		{"context deadline exceeded", "timeout"},
+		{"context canceled", "cancelled"},
+		{ErrServerBusy.Error(), "busy"},
+		{ErrRateLimited.Error(), "rate_limited"},
+		{"PRAGMA statements are not allowed", "denied"},
+		{"string or blob too big (18)", "limit"},
+		{"SQL logic error: no such column: foo (1)", "sql"},
+	}
+
+	for _, c := range cases {
+		if ErrorType(c.message) != c.expected {
+			t.Errorf("ErrorType(%q) == %v, want %v", c.message, ErrorType(c.message), c.expected)
+		}
+	}
+}
+
+func TestTrackQuery(t *testing.T) {
+	db, done, _ := testEngine.UseDatabase(DefaultDataset)
+	defer done()
+
+	e := New(db, testOptions())
+
+	timeoutCtx, cancelTimeout := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancelTimeout()
+	<-timeoutCtx.Done()
+	e.trackQuery(timeoutCtx)()
+
+	cancelCtx, cancel := context.WithCancel(context.Background())
+	finished := e.trackQuery(cancelCtx)
+
+	if e.ActiveQueries() != 1 {
+		t.Errorf("ActiveQueries() == %d, want 1", e.ActiveQueries())
+	}
+
+	cancel()
+	finished()
+
+	if e.ActiveQueries() != 0 {
+		t.Errorf("ActiveQueries() == %d, want 0", e.ActiveQueries())
+	}
+
+	if e.CancelledQueries() != 1 {
+		t.Errorf("CancelledQueries() == %d, want 1", e.CancelledQueries())
+	}
+}
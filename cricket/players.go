@@ -0,0 +1,106 @@
+package cricket
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/jmoiron/sqlx"
+	sqlite3 "modernc.org/sqlite"
+)
+
+// playerDirectory maps names to the player_ids that have had them in one
+// database, for the player_id() function.
+type playerDirectory struct {
+	ids map[string][]string
+}
+
+// SQL functions can't query the connection they're called on, or even tell
+// which one it is. So each database builds its directory when it's opened,
+// and queries pass player_id() the database's key to look it up here.
+var openDatabases sync.Map
+var lastDatabaseKey atomic.Int64
+
+var matchPlayerIdCall = regexp.MustCompile(`(?i)\bplayer_id\s*\(`)
+
+// loadPlayerDirectory reads the players in db. A database built before the
+// players table existed gets an empty directory, and player_id() will say
+// it doesn't know anyone.
+func loadPlayerDirectory(db *sqlx.DB) *playerDirectory {
+	var rows []struct {
+		Player   string `db:"player"`
+		PlayerId string `db:"player_id"`
+	}
+
+	p := &playerDirectory{ids: make(map[string][]string)}
+
+	if err := db.Select(&rows, "SELECT DISTINCT player, player_id FROM players;"); err != nil {
+		return p
+	}
+
+	for _, row := range rows {
+		name := strings.ToLower(row.Player)
+
+		if !inArray(row.PlayerId, p.ids[name]) {
+			p.ids[name] = append(p.ids[name], row.PlayerId)
+			sort.Strings(p.ids[name])
+		}
+	}
+
+	return p
+}
+
+// lookup returns the only player_id that has had name, ignoring case.
+func (p *playerDirectory) lookup(name string) (string, error) {
+	ids := p.ids[strings.ToLower(strings.TrimSpace(name))]
+
+	switch len(ids) {
+	case 0:
+		return "", fmt.Errorf("player_id: no player is called %q", name)
+	case 1:
+		return ids[0], nil
+	default:
+		return "", fmt.Errorf("player_id: %q is ambiguous: it could be %s", name, strings.Join(ids, ", "))
+	}
+}
+
+// bindPlayerIds passes the database's key as the first argument of every
+// player_id() call in sql, leaving literals and comments alone.
+func (d *Database) bindPlayerIds(sql string) string {
+	var out strings.Builder
+
+	bound := fmt.Sprintf("${0}%d, ", d.key)
+	last := 0
+
+	for _, quoted := range append(matchQuoted.FindAllStringIndex(sql, -1), []int{len(sql), len(sql)}) {
+		out.WriteString(matchPlayerIdCall.ReplaceAllString(sql[last:quoted[0]], bound))
+		out.WriteString(sql[quoted[0]:quoted[1]])
+		last = quoted[1]
+	}
+
+	return out.String()
+}
+
+// playerIdFunction is player_id(key, name), where bindPlayerIds supplies
+// the key.
+func playerIdFunction(ctx *sqlite3.FunctionContext, args []driver.Value) (driver.Value, error) {
+	key, _ := args[0].(int64)
+	d, ok := openDatabases.Load(key)
+
+	if !ok {
+		return nil, fmt.Errorf("player_id: unknown database %d", key)
+	}
+
+	switch name := args[1].(type) {
+	case string:
+		return d.(*Database).players.lookup(name)
+	case nil:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("player_id: name is not text: %T", name)
+	}
+}
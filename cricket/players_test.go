@@ -0,0 +1,124 @@
+package cricket
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/jmoiron/sqlx"
+)
+
+func TestPlayerDirectory(t *testing.T) {
+	directory := &playerDirectory{ids: map[string][]string{
+		"spd smith": []string{"p267192"},
+		"c smith":   []string{"p1", "p2"},
+	}}
+
+	cases := []struct {
+		name     string
+		expected string
+		err      string
+	}{
+		{"SPD Smith", "p267192", ""},
+		{" spd smith ", "p267192", ""},
+		{"C Smith", "", `player_id: "C Smith" is ambiguous: it could be p1, p2`},
+		{"Nobody", "", `player_id: no player is called "Nobody"`},
+	}
+
+	for _, c := range cases {
+		result, err := directory.lookup(c.name)
+
+		if result != c.expected || (err == nil && c.err != "") || (err != nil && err.Error() != c.err) {
+			t.Errorf("lookup(%q) == %q, %v, want %q, %q", c.name, result, err, c.expected, c.err)
+		}
+	}
+}
+
+func TestPlayerIdFunction(t *testing.T) {
+	cases := []struct {
+		sql      string
+		expected Result
+	}{
+		{
+			"SELECT player_id('C Bannerman') AS id;",
+			Result{Columns: []string{"id"}, Rows: [][]any{{"p4091"}}, Messages: []string{}},
+		},
+		{
+			"SELECT player_id(NULL) AS id;",
+			Result{Columns: []string{"id"}, Rows: [][]any{{nil}}, Messages: []string{}},
+		},
+		{
+			"SELECT player_id('Nobody') AS id;",
+			Result{Messages: []string{`SQL logic error: player_id: no player is called "Nobody" (1)`}},
+		},
+	}
+
+	for _, c := range cases {
+		result := testEngine.RunQuery(context.Background(), c.sql, 1, 1000)
+		result.Duration = 0
+
+		if diff := cmp.Diff(c.expected, result); diff != "" {
+			t.Errorf("runQuery(%q) mismatch (-expected +result):\n%s", c.sql, diff)
+		}
+	}
+}
+
+func TestBindPlayerIds(t *testing.T) {
+	d := &Database{key: 7}
+
+	cases := []struct {
+		sql      string
+		expected string
+	}{
+		{"SELECT player_id('A');", "SELECT player_id(7, 'A');"},
+		{"SELECT PLAYER_ID ('A'), player_id(player) FROM x;", "SELECT PLAYER_ID (7, 'A'), player_id(7, player) FROM x;"},
+		{"SELECT player_id FROM x WHERE player = 'player_id(';", "SELECT player_id FROM x WHERE player = 'player_id(';"},
+		{"-- player_id(\nSELECT \"player_id(\";", "-- player_id(\nSELECT \"player_id(\";"},
+	}
+
+	for _, c := range cases {
+		if result := d.bindPlayerIds(c.sql); result != c.expected {
+			t.Errorf("bindPlayerIds(%q) == %q, want %q", c.sql, result, c.expected)
+		}
+	}
+}
+
+func TestPlayerIdDataset(t *testing.T) {
+	e := snapshotEngine(t)
+	snapshot, done, _ := e.UseDatabase("snapshot")
+	done()
+
+	// The snapshot's directory was built when it was opened, so give it a
+	// different player in a copy.
+	path := filepath.Join(t.TempDir(), "renamed.sqlite3")
+	content, err := os.ReadFile(snapshot.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	os.WriteFile(path, content, 0644)
+	sqlx.MustConnect("sqlite", path).MustExec("UPDATE players SET player_id = 'p1' WHERE player = 'C Bannerman';")
+	e.setDatabase("snapshot", MustOpen(path)).Close()
+
+	cases := []struct {
+		dataset  string
+		expected string
+	}{
+		{DefaultDataset, "p4091"},
+		{"snapshot", "p1"},
+	}
+
+	for _, c := range cases {
+		result := e.RunQuery(WithDataset(context.Background(), c.dataset), "SELECT player_id('C Bannerman');", 1, 1000)
+
+		if len(result.Rows) != 1 || result.Rows[0][0] != c.expected {
+			t.Errorf("player_id() on dataset %q == %v, want %q", c.dataset, result, c.expected)
+		}
+	}
+
+	if _, ok := openDatabases.Load(snapshot.key); ok {
+		t.Errorf("a closed database is still open to player_id()")
+	}
+}
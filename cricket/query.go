@@ -0,0 +1,294 @@
+package cricket
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	sqlite3 "modernc.org/sqlite"
+)
+
+// Query is SQL to run for each of the checked formats and genders, with
+// the table aliases from AddAliases, against a dataset (or the default, if
+// Dataset is blank).
+type Query struct {
+	Formats     []Checkbox
+	Genders     []Checkbox
+	SQL         string
+	Subtitle    string
+	Description string
+	Dataset     string
+}
+
+// Result is what one run of a query returned. Errors are in Messages, and
+// Truncated is set when there were more rows than the limit.
+type Result struct {
+	Columns   []string
+	Rows      [][]any
+	Messages  []string
+	Duration  time.Duration
+	Truncated bool
+}
+
+// LabelledResult is a Result for one projection: "Men's Test" and so on.
+type LabelledResult struct {
+	Header string
+	Id     string
+	Result Result
+}
+
+type Checkbox struct {
+	Label   string
+	Value   string
+	Checked bool
+}
+
+// FormatValues and GenderValues are the projections, unchecked.
+var FormatValues = []Checkbox{
+	Checkbox{"Test", "test", false},
+	Checkbox{"ODI", "odi", false},
+	Checkbox{"T20I", "t20i", false},
+}
+
+var GenderValues = []Checkbox{
+	Checkbox{"Men", "men", false},
+	Checkbox{"Women", "women", false},
+}
+
+var startsWithWith = regexp.MustCompile(`(?i)\AWITH`)
+
+type medianFunction struct {
+	vals []float64
+}
+
+func (f *medianFunction) Step(ctx *sqlite3.FunctionContext, args []driver.Value) error {
+	switch resTyped := args[0].(type) {
+	case int64:
+		f.vals = append(f.vals, float64(resTyped))
+	case float64:
+		f.vals = append(f.vals, resTyped)
+	case nil:
+	default:
+		return fmt.Errorf("value is not a number: %T", resTyped)
+	}
+	return nil
+}
+
+func (f *medianFunction) WindowInverse(ctx *sqlite3.FunctionContext, args []driver.Value) error {
+	first, rest := f.vals[0], f.vals[1:]
+
+	switch resTyped := args[0].(type) {
+	case int64:
+		if first == float64(resTyped) {
+			f.vals = rest
+		}
+	case float64:
+		if first == resTyped {
+			f.vals = rest
+		}
+	case nil:
+	default:
+		return fmt.Errorf("value is not a number: %T", resTyped)
+	}
+	return nil
+}
+
+func (f *medianFunction) WindowValue(ctx *sqlite3.FunctionContext) (driver.Value, error) {
+	l := len(f.vals)
+
+	sort.Float64s(f.vals)
+
+	if l == 0 {
+		return int64(0), nil
+	} else if l%2 == 0 {
+		return (f.vals[l/2-1] + f.vals[l/2]) / 2, nil
+	} else {
+		return f.vals[l/2], nil
+	}
+}
+
+func (f *medianFunction) Final(ctx *sqlite3.FunctionContext) {}
+
+// CheckedValues returns the values of the checked checkboxes.
+func CheckedValues(checkboxes []Checkbox) (out []string) {
+	for _, checkbox := range checkboxes {
+		if checkbox.Checked {
+			out = append(out, checkbox.Value)
+		}
+	}
+
+	return
+}
+
+// CheckboxValues copies checkboxes, checking those with a value in checked,
+// or all of them if checked is empty.
+func CheckboxValues(checkboxes []Checkbox, checked []string) (out []Checkbox) {
+	for _, checkbox := range checkboxes {
+		out = append(
+			out,
+			Checkbox{
+				checkbox.Label,
+				checkbox.Value,
+				len(checked) == 0 || inArray(checkbox.Value, checked),
+			},
+		)
+	}
+
+	return
+}
+
+// ProjectQuery runs query for each of its checked formats and genders.
+func (e *Engine) ProjectQuery(ctx context.Context, query Query, limit int, timeout int) (out []LabelledResult) {
+	for _, format := range query.Formats {
+		for _, gender := range query.Genders {
+			if format.Checked && gender.Checked {
+				id := fmt.Sprintf("%s-%s", gender.Value, format.Value)
+				result := e.RunQuery(ctx, AddAliases(gender.Value, format.Value, query.SQL), limit, timeout)
+
+				e.observe(id, result)
+				e.logQuery(ctx, id, query.SQL, result)
+				out = append(out, LabelledResult{
+					fmt.Sprintf("%s's %s", gender.Label, format.Label),
+					id,
+					result,
+				})
+			}
+		}
+	}
+
+	return
+}
+
+// RunQuery runs sql as it is, returning at most limit rows, once there's
+// a free slot in the limiter.
+func (e *Engine) RunQuery(ctx context.Context, sql string, limit int, timeout int) Result {
+	release, err := e.Limiter.Acquire(ctx)
+	if err != nil {
+		return Result{Messages: []string{err.Error()}}
+	}
+	defer release()
+
+	messages := make([]string, 0)
+	rows := make([][]any, 0)
+	truncated := false
+	i := 1
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(ctx, milliseconds(timeout))
+	defer cancel()
+	defer e.trackQuery(ctx)()
+
+	conn, bound, err := e.guardedConn(ctx, sql)
+	if err != nil {
+		return Result{Messages: []string{err.Error()}, Duration: time.Now().Sub(start)}
+	}
+	failed := false
+	defer func() { closeConn(conn, failed) }()
+
+	results, err := conn.QueryxContext(ctx, bound)
+	elapsed := time.Now().Sub(start)
+
+	if err == nil {
+		err = ctx.Err()
+	}
+
+	if err != nil {
+		failed = true
+		return Result{Messages: []string{err.Error()}, Duration: elapsed}
+	}
+
+	defer results.Close()
+
+	columns, err := results.Columns()
+	if err != nil {
+		messages = append(messages, err.Error())
+	}
+
+	for results.Next() {
+		if i > limit {
+			messages = append(messages, fmt.Sprintf("Too many rows returned; stopping at %d", limit))
+			truncated = true
+			break
+		}
+
+		cols, err := results.SliceScan()
+		if err != nil {
+			messages = append(messages, err.Error())
+		}
+
+		rows = append(rows, cols)
+		i += 1
+	}
+
+	if err := results.Err(); err != nil {
+		failed = true
+		messages = append(messages, err.Error())
+	}
+
+	return Result{
+		Columns:   columns,
+		Rows:      rows,
+		Messages:  messages,
+		Duration:  elapsed,
+		Truncated: truncated,
+	}
+}
+
+// SelectRows runs one of our own queries, which take arguments and scan
+// into structs, under the same limiter, guards and timeout as RunQuery.
+// dest must point to a slice. The query is counted and logged under label.
+func (e *Engine) SelectRows(ctx context.Context, label string, dest any, sql string, args ...any) error {
+	start := time.Now()
+	release, err := e.Limiter.Acquire(ctx)
+
+	if err == nil {
+		defer release()
+
+		ctx, cancel := context.WithTimeout(ctx, milliseconds(e.Timeout))
+		defer cancel()
+		defer e.trackQuery(ctx)()
+
+		var conn *sqlx.Conn
+		var bound string
+
+		if conn, bound, err = e.guardedConn(ctx, sql); err == nil {
+			err = conn.SelectContext(ctx, dest, bound, args...)
+			closeConn(conn, err != nil)
+		}
+	}
+
+	// The metrics and log only need the outcome, so this stands in for a
+	// Result with as many rows as were scanned.
+	summary := Result{Messages: []string{}, Duration: time.Now().Sub(start)}
+
+	if err != nil {
+		summary.Messages = append(summary.Messages, err.Error())
+	} else {
+		summary.Rows = make([][]any, reflect.ValueOf(dest).Elem().Len())
+	}
+
+	e.observe(label, summary)
+	e.logQuery(ctx, label, sql, summary)
+
+	return err
+}
+
+// AddAliases defines innings, bowling_innings and team_innings as the
+// tables for a gender and format, so that the same SQL works for each.
+func AddAliases(gender string, format string, sql string) string {
+	if startsWithWith.Match([]byte(sql)) {
+		sql = startsWithWith.ReplaceAllString(sql, ",")
+	}
+
+	return fmt.Sprintf(`
+WITH
+innings AS (SELECT * FROM %[1]s_%[2]s_batting_innings),
+bowling_innings AS (SELECT * FROM %[1]s_%[2]s_bowling_innings),
+team_innings AS (SELECT * FROM %[1]s_%[2]s_team_innings)
+%[3]s
+`, gender, format, sql)
+}
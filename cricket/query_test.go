@@ -0,0 +1,282 @@
+package cricket
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestProjectQuery(t *testing.T) {
+	rows := make([][]interface{}, 1)
+	rows[0] = make([]interface{}, 1)
+	rows[0][0] = int64(25)
+	ctx := context.Background()
+
+	cases := []struct {
+		query    Query
+		limit    int
+		expected []LabelledResult
+	}{
+		{
+			Query{
+				Formats: CheckboxValues(FormatValues, []string{"odi", "t20i"}),
+				Genders: CheckboxValues(GenderValues, []string{"men"}),
+				// Using full table names means that the projected
+				// tables don't apply.
+				SQL: "SELECT runs FROM women_test_batting_innings WHERE runs IS NOT NULL ORDER BY runs DESC LIMIT 1;",
+			},
+			1,
+			[]LabelledResult{
+				LabelledResult{
+					Header: "Men's ODI",
+					Id:     "men-odi",
+					Result: Result{
+						Columns:  []string{"runs"},
+						Rows:     rows,
+						Messages: []string{},
+					},
+				},
+				LabelledResult{
+					Header: "Men's T20I",
+					Id:     "men-t20i",
+					Result: Result{
+						Columns:  []string{"runs"},
+						Rows:     rows,
+						Messages: []string{},
+					},
+				},
+			},
+		},
+		{
+			Query{
+				Formats: CheckboxValues(FormatValues, []string{"test"}),
+				Genders: CheckboxValues(GenderValues, []string{"women"}),
+				SQL:     "SELECT runs FROM innings WHERE runs IS NOT NULL ORDER BY runs DESC LIMIT 1;",
+			},
+			1,
+			[]LabelledResult{
+				LabelledResult{
+					Header: "Women's Test",
+					Id:     "women-test",
+					Result: Result{
+						Columns:  []string{"runs"},
+						Rows:     rows,
+						Messages: []string{},
+					},
+				},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		result := testEngine.ProjectQuery(ctx, c.query, c.limit, 100)
+
+		if diff := cmp.Diff(c.expected, result, ignoreDuration); diff != "" {
+			t.Errorf("projectQuery(ctx, %v, %d, 100) mismatch (-expected +result):\n%s", c.query, c.limit, diff)
+		}
+
+		for _, r := range result {
+			if r.Result.Duration > 100000000 || r.Result.Duration == 0 {
+				t.Errorf("projectQuery(ctx, %v, %d, 100) unexpected duration: %s", c.query, c.limit, r.Result.Duration)
+			}
+		}
+	}
+}
+
+func TestRunQuery(t *testing.T) {
+	ctx := context.Background()
+
+	cases := []struct {
+		sql      string
+		limit    int
+		expected Result
+	}{
+		{
+			"SELECT runs FROM women_test_batting_innings WHERE runs IS NOT NULL ORDER BY runs ASC;",
+			1,
+			Result{
+				Columns:   []string{"runs"},
+				Rows:      makeSingleRow(int64(0)),
+				Messages:  []string{"Too many rows returned; stopping at 1"},
+				Truncated: true,
+			},
+		},
+		{
+			"SELECT runs FROM women_test_batting_innings WHERE runs IS NOT NULL ORDER BY runs ASC LIMIT 1;",
+			2,
+			Result{
+				Columns:  []string{"runs"},
+				Rows:     makeSingleRow(int64(0)),
+				Messages: []string{},
+			},
+		},
+		{
+			"SELECT median(mins) FROM women_test_batting_innings;",
+			1,
+			Result{
+				Columns:  []string{"median(mins)"},
+				Rows:     makeSingleRow(int64(0)),
+				Messages: []string{},
+			},
+		},
+		{
+			"SELECT median(runs) FROM (SELECT runs FROM women_test_batting_innings ORDER BY runs DESC LIMIT 2);",
+			1,
+			Result{
+				Columns:  []string{"median(runs)"},
+				Rows:     makeSingleRow(float64(14.5)),
+				Messages: []string{},
+			},
+		},
+		{
+			"UPDATE women_test_batting_innings SET runs = 100;",
+			1,
+			Result{Messages: []string{"attempt to write a readonly database (8)"}},
+		},
+		{
+			"SELECT 1; PRAGMA query_only = 0;",
+			1,
+			Result{Messages: []string{"PRAGMA statements are not allowed"}},
+		},
+		{
+			"ATTACH DATABASE 'testdata/other.sqlite3' AS other;",
+			1,
+			Result{Messages: []string{"ATTACH statements are not allowed"}},
+		},
+		{
+			"SELECT load_extension('testdata/extension');",
+			1,
+			Result{Messages: []string{"SQL logic error: not authorized (1)"}},
+		},
+		{
+			"SELECT length(randomblob(2000000));",
+			1,
+			Result{Messages: []string{"string or blob too big (18)"}},
+		},
+		{
+			"SELECT 1; -- " + strings.Repeat("x", 100000),
+			1,
+			Result{Messages: []string{"string or blob too big (18)"}},
+		},
+		{
+			"SELECT 1" + strings.Repeat(" UNION SELECT 1", 50) + ";",
+			1,
+			Result{Messages: []string{"SQL logic error: too many terms in compound SELECT (1)"}},
+		},
+		{
+			"SELECT " + strings.Repeat("(SELECT max(runs) FROM men_test_batting_innings), ", 1600) + "1;",
+			1,
+			Result{Messages: []string{"out of memory (7)"}},
+		},
+		{
+			// https://dba.stackexchange.com/a/203607
+			"WITH RECURSIVE r(i) AS (VALUES(0) UNION ALL SELECT i FROM r LIMIT 10000000) SELECT i FROM r WHERE i = 1;",
+			1,
+			Result{Messages: []string{"interrupted (9)"}},
+		},
+		{
+			"SELECT test_sleep_150();",
+			1,
+			Result{Messages: []string{"context deadline exceeded"}},
+		},
+	}
+
+	for _, c := range cases {
+		result := testEngine.RunQuery(ctx, c.sql, c.limit, 100)
+
+		if diff := cmp.Diff(c.expected, result, ignoreDuration); diff != "" {
+			t.Errorf("runQuery(ctx, %q, %d, 100) mismatch (-expected +result):\n%s", c.sql, c.limit, diff)
+		}
+
+		// Add padding for timeout tests
+		if result.Duration > 200000000 || result.Duration == 0 {
+			t.Errorf("runQuery(ctx, %q, %d, 100) unexpected duration: %v", c.sql, c.limit, result.Duration)
+		}
+	}
+}
+
+func TestAddAliases(t *testing.T) {
+	cases := []struct {
+		gender   string
+		format   string
+		sql      string
+		expected string
+	}{
+		{
+			"men",
+			"t20i",
+			"WITH foo AS (SELECT * FROM bar) SELECT COUNT(*) FROM foo;",
+			`
+WITH
+innings AS (SELECT * FROM men_t20i_batting_innings),
+bowling_innings AS (SELECT * FROM men_t20i_bowling_innings),
+team_innings AS (SELECT * FROM men_t20i_team_innings)
+, foo AS (SELECT * FROM bar) SELECT COUNT(*) FROM foo;
+`,
+		},
+		{
+			"women",
+			"test",
+			"SELECT COUNT(*) FROM foo;",
+			`
+WITH
+innings AS (SELECT * FROM women_test_batting_innings),
+bowling_innings AS (SELECT * FROM women_test_bowling_innings),
+team_innings AS (SELECT * FROM women_test_team_innings)
+SELECT COUNT(*) FROM foo;
+`,
+		},
+	}
+
+	for _, c := range cases {
+		if AddAliases(c.gender, c.format, c.sql) != c.expected {
+			t.Errorf("AddAliases(%q, %q, %q) == %v, want %v", c.gender, c.format, c.sql, AddAliases(c.gender, c.format, c.sql), c.expected)
+		}
+	}
+}
+
+func TestCheckboxValues(t *testing.T) {
+	cases := []struct {
+		checkboxes []Checkbox
+		checked    []string
+		expected   []Checkbox
+	}{
+		{
+			FormatValues,
+			[]string{"t20i"},
+			[]Checkbox{
+				Checkbox{"Test", "test", false},
+				Checkbox{"ODI", "odi", false},
+				Checkbox{"T20I", "t20i", true},
+			},
+		},
+		{
+			FormatValues,
+			[]string{"test", "t20i"},
+			[]Checkbox{
+				Checkbox{"Test", "test", true},
+				Checkbox{"ODI", "odi", false},
+				Checkbox{"T20I", "t20i", true},
+			},
+		},
+		{
+			FormatValues,
+			[]string{},
+			[]Checkbox{
+				Checkbox{"Test", "test", true},
+				Checkbox{"ODI", "odi", true},
+				Checkbox{"T20I", "t20i", true},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		result := CheckboxValues(c.checkboxes, c.checked)
+		if fmt.Sprintf("%v", result) != fmt.Sprintf("%v", c.expected) {
+			t.Errorf("CheckboxValues(%v, %v) == %v, want %v", c.checkboxes, c.checked, result, c.expected)
+		}
+	}
+}
@@ -0,0 +1,19 @@
+package main
+
+import (
+	"net/http"
+
+	"sean.mcgivern.me.uk/cricket-query/cricket"
+)
+
+// requestDataset returns the named dataset, or responds with a 404 if there
+// isn't one.
+func (s *Server) requestDataset(w http.ResponseWriter, r *http.Request, name string) (cricket.Dataset, bool) {
+	dataset, err := s.engine.FindDataset(name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return dataset, false
+	}
+
+	return dataset, true
+}
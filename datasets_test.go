@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"sean.mcgivern.me.uk/cricket-query/cricket"
+)
+
+// snapshotServer returns a server with the test data as the default
+// dataset, and a snapshot with only the men's Test innings of under fifty.
+func snapshotServer(t *testing.T) *Server {
+	live, done, _ := testEngine.UseDatabase(cricket.DefaultDataset)
+	done()
+
+	content, err := os.ReadFile(live.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "snapshot.sqlite3")
+	os.WriteFile(path, content, 0644)
+	sqlx.MustConnect("sqlite", path).MustExec("DELETE FROM men_test_batting_innings WHERE runs >= 50;")
+
+	e := newEngine(live, defaultConfig())
+	e.Mount(cricket.Dataset{Name: "snapshot", Path: path, Description: "Under fifty", Date: "2023-09-30"}, cricket.MustOpen(path))
+
+	return newServer(defaultConfig(), e, testServer.store)
+}
+
+func TestDatasets(t *testing.T) {
+	s := snapshotServer(t)
+	sql := "SELECT count(*) FROM men_test_batting_innings WHERE runs >= 50;"
+
+	cases := []struct {
+		dataset  string
+		expected bool
+	}{
+		{"", true},
+		{"live", true},
+		{"snapshot", false},
+	}
+
+	for _, c := range cases {
+		result := s.engine.RunQuery(cricket.WithDataset(context.Background(), c.dataset), sql, 1, 1000)
+
+		if len(result.Rows) != 1 || (result.Rows[0][0].(int64) > 0) != c.expected {
+			t.Errorf("runQuery() on dataset %q == %v", c.dataset, result)
+		}
+	}
+
+	if result := s.engine.RunQuery(cricket.WithDataset(context.Background(), "missing"), sql, 1, 1000); len(result.Rows) > 0 || len(result.Messages) != 1 || !strings.Contains(result.Messages[0], "no such dataset") {
+		t.Errorf("runQuery() on a missing dataset == %v, want an error", result)
+	}
+
+	if dataset, err := s.engine.FindDataset("missing"); !errors.Is(err, cricket.ErrNoDataset) {
+		t.Errorf("dataset(%q) == %v, %v, want %v", "missing", dataset, err, cricket.ErrNoDataset)
+	}
+}
+
+func TestIndexDataset(t *testing.T) {
+	s := snapshotServer(t)
+	s.engine.SavedQueries = map[string]cricket.Query{
+		"pinned": cricket.Query{
+			SQL:     "SELECT count(*) FROM innings;",
+			Formats: cricket.CheckboxValues(cricket.FormatValues, []string{"test"}),
+			Genders: cricket.CheckboxValues(cricket.GenderValues, []string{"men"}),
+			Dataset: "snapshot",
+		},
+	}
+
+	cases := []struct {
+		query    url.Values
+		expected string
+	}{
+		{url.Values{"sql": []string{"SELECT 1;"}}, "live"},
+		{url.Values{"sql": []string{"SELECT 1;"}, "dataset": []string{"snapshot"}}, "snapshot"},
+		{url.Values{"query": []string{"pinned"}, "dataset": []string{"live"}}, "snapshot"},
+	}
+
+	for _, c := range cases {
+		w := httptest.NewRecorder()
+		s.index(w, httptest.NewRequest("GET", s.baseUrl("/?"+c.query.Encode()), nil))
+
+		if !strings.Contains(w.Body.String(), `<option value="`+c.expected+`" selected>`) || !strings.Contains(w.Body.String(), "Dataset: "+c.expected) {
+			t.Errorf("index(%v) did not use dataset %q:\n%s", c.query, c.expected, w.Body.String())
+		}
+	}
+
+	w := httptest.NewRecorder()
+	s.index(w, httptest.NewRequest("GET", s.baseUrl("/?dataset=snapshot"), nil))
+
+	if !strings.Contains(w.Body.String(), "(data as of 30 September 2023)") {
+		t.Errorf("index() did not show the snapshot's date:\n%s", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	testServer.index(w, httptest.NewRequest("GET", testServer.baseUrl("/"), nil))
+
+	if strings.Contains(w.Body.String(), `<select name="dataset"`) {
+		t.Errorf("index() with one dataset showed a dataset selector")
+	}
+}
+
+func TestUnknownDataset(t *testing.T) {
+	s := snapshotServer(t)
+	s.engine.SavedQueries = map[string]cricket.Query{
+		"removed": cricket.Query{SQL: "SELECT 1;", Dataset: "removed"},
+	}
+
+	stale := newPermalink(cricket.Query{SQL: "SELECT 1;", Dataset: "removed"})
+	if err := savePermalink(s.store, stale); err != nil {
+		t.Fatal(err)
+	}
+
+	paths := []string{
+		"/?dataset=missing",
+		"/?compare=missing&diff=1",
+		"/?query=removed",
+		"/q/" + stale.Id,
+		"/compare/?a=SELECT+1&b=SELECT+2&dataset=missing",
+		"/player/p1?dataset=missing",
+		"/match/m1?dataset=missing",
+		"/ground/?ground=Lord%27s&dataset=missing",
+		"/api/players?q=smith&dataset=missing",
+		"/help/data-quality?dataset=missing",
+	}
+
+	for _, path := range paths {
+		w := httptest.NewRecorder()
+		s.handler().ServeHTTP(w, httptest.NewRequest("GET", s.baseUrl(path), nil))
+
+		if w.Code != 404 || !strings.Contains(w.Body.String(), "no such dataset") {
+			t.Errorf("handler() for %q == %d %q, want 404", path, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestPermalinkDataset(t *testing.T) {
+	s := snapshotServer(t)
+	query := cricket.Query{
+		SQL:     "SELECT * FROM innings;",
+		Formats: cricket.CheckboxValues(cricket.FormatValues, []string{}),
+		Genders: cricket.CheckboxValues(cricket.GenderValues, []string{}),
+	}
+	unset := newPermalink(query)
+
+	query.Dataset = cricket.DefaultDataset
+
+	if permalink := newPermalink(query); permalink.Id != unset.Id || permalink.Dataset != "" {
+		t.Errorf("newPermalink() for the default dataset == %v, want %v", permalink, unset)
+	}
+
+	query.Dataset = "snapshot"
+
+	if permalink := newPermalink(query); permalink.Id == unset.Id || permalink.Dataset != "snapshot" {
+		t.Errorf("newPermalink() for a snapshot == %v", permalink)
+	}
+
+	form := url.Values{"sql": []string{"SELECT 2;"}, "dataset": []string{"snapshot"}}
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", s.baseUrl("/q/"), strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	s.permalinks(w, r)
+
+	location := w.Header().Get("Location")
+	w = httptest.NewRecorder()
+	s.permalinks(w, httptest.NewRequest("GET", location, nil))
+
+	if !strings.Contains(w.Body.String(), `<option value="snapshot" selected>`) {
+		t.Errorf("permalinks(GET %q) did not use the snapshot", location)
+	}
+}
+
+func TestConnectStoreWithoutDataset(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "permalinks.sqlite3")
+	sqlx.MustConnect("sqlite", path).MustExec(`
+CREATE TABLE permalinks (id text PRIMARY KEY, sql text NOT NULL, formats text NOT NULL, genders text NOT NULL, subtitle text NOT NULL, description text NOT NULL, created_at text NOT NULL);
+INSERT INTO permalinks VALUES ('old', 'SELECT 1;', '', '', '', '', '2023-01-01T00:00:00Z');`)
+
+	store := connectStore(path)
+
+	if permalink, err := loadPermalink(store, "old"); err != nil || permalink.Dataset != "" {
+		t.Errorf("loadPermalink(store, %q) == %v, %v", "old", permalink, err)
+	}
+
+	if err := savePermalink(store, newPermalink(cricket.Query{SQL: "SELECT 2;", Dataset: "snapshot"})); err != nil {
+		t.Errorf("savePermalink() after adding the dataset column returned %v", err)
+	}
+}
+
+func TestReadyzDatasets(t *testing.T) {
+	live, done, _ := testEngine.UseDatabase(cricket.DefaultDataset)
+	done()
+
+	path := filepath.Join(t.TempDir(), "empty.sqlite3")
+	sqlx.MustConnect("sqlite", path).MustExec("CREATE TABLE men_test_batting_innings (runs integer);")
+
+	e := newEngine(live, defaultConfig())
+	e.Mount(cricket.Dataset{Name: "empty", Path: path}, cricket.MustOpen(path))
+
+	w := httptest.NewRecorder()
+	newServer(defaultConfig(), e, nil).readyz(w, httptest.NewRequest("GET", "/readyz", nil))
+
+	if w.Code != 503 || !strings.Contains(w.Body.String(), `"empty: men_test_batting_innings: no rows"`) {
+		t.Errorf("readyz() with an empty dataset == %d %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestIndexDiff(t *testing.T) {
+	s := snapshotServer(t)
+	query := url.Values{
+		"sql":     []string{"SELECT player_id, match_id, innings, runs FROM innings WHERE runs >= 40;"},
+		"format":  []string{"test"},
+		"gender":  []string{"men"},
+		"diff":    []string{"Diff"},
+		"compare": []string{"snapshot"},
+	}
+
+	w := httptest.NewRecorder()
+	s.index(w, httptest.NewRequest("GET", s.baseUrl("/?"+query.Encode()), nil))
+
+	if !strings.Contains(w.Body.String(), "Men&#39;s Test changes since snapshot") || !strings.Contains(w.Body.String(), `<tr class="added">`) || !strings.Contains(w.Body.String(), " added, 0 removed, 0 changed.") {
+		t.Errorf("index(%v) did not show a diff:\n%s", query, w.Body.String())
+	}
+
+	// Without a dataset to compare against, the diff is against the only
+	// other one.
+	query.Del("compare")
+	query.Set("dataset", "snapshot")
+	w = httptest.NewRecorder()
+	s.index(w, httptest.NewRequest("GET", s.baseUrl("/?"+query.Encode()), nil))
+
+	if !strings.Contains(w.Body.String(), "Men&#39;s Test changes since live") || !strings.Contains(w.Body.String(), "0 added, ") {
+		t.Errorf("index(%v) did not diff against live:\n%s", query, w.Body.String())
+	}
+
+	if strings.Contains(w.Body.String(), "This diff is incomplete") {
+		t.Errorf("index(%v) marked a complete diff as incomplete", query)
+	}
+
+	// Diffs have their own, higher, limit, and say when they hit it.
+	query.Set("sql", "SELECT player_id, match_id, innings, runs FROM innings;")
+	s.engine.RowsLimit = 1
+	s.engine.DiffRowsLimit = 3
+	s.config.DiffRowsLimit = 3
+	w = httptest.NewRecorder()
+	s.index(w, httptest.NewRequest("GET", s.baseUrl("/?"+query.Encode()), nil))
+
+	if !strings.Contains(w.Body.String(), "only the first 3 rows of each dataset were compared") {
+		t.Errorf("index(%v) did not mark a truncated diff as incomplete:\n%s", query, w.Body.String())
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import "sean.mcgivern.me.uk/cricket-query/cricket"
+
+// Engine is the query engine, with the queries behind the server's own
+// pages on top: players, scorecards, summaries and the data-quality report.
+type Engine struct {
+	*cricket.Engine
+}
+
+// Keys for what the pages keep in a database's Values, which a reload
+// drops along with the database.
+type databaseValue string
+
+const (
+	playerQueriesValue   databaseValue = "player-queries"
+	teamsAndGroundsValue databaseValue = "teams-and-grounds"
+	qualityValue         databaseValue = "quality"
+	buildingQualityValue databaseValue = "building-quality"
+)
+
+// newEngine returns an engine for d with the limits in c, which logs and
+// counts its queries with the server's logger and metrics.
+func newEngine(d *cricket.Database, c Config) *Engine {
+	return &Engine{cricket.New(d, cricket.Options{
+		RowsLimit:     c.RowsLimit,
+		DiffRowsLimit: c.DiffRowsLimit,
+		Timeout:       c.Timeout,
+		RedactSQL:     c.RedactSQL,
+		SavedQueries:  savedQueries,
+		MaxQueries:    c.MaxQueries,
+		QueueTimeout:  c.QueueTimeout,
+		RateLimit:     c.RateLimit,
+		RateBurst:     c.RateBurst,
+		Logger:        logger,
+		Observe:       observeQuery,
+	})}
+}
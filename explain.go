@@ -0,0 +1,31 @@
+package main
+
+import (
+	"context"
+	"net/url"
+
+	"sean.mcgivern.me.uk/cricket-query/cricket"
+)
+
+func timedOut(result cricket.Result) bool {
+	for _, message := range result.Messages {
+		if message == "interrupted (9)" || message == context.DeadlineExceeded.Error() {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *Server) explainUrl(query cricket.Query) string {
+	values := url.Values{"sql": []string{query.SQL}, "explain": []string{"1"}}
+
+	values["format"] = cricket.CheckedValues(query.Formats)
+	values["gender"] = cricket.CheckedValues(query.Genders)
+
+	if query.Dataset != "" && query.Dataset != cricket.DefaultDataset {
+		values.Set("dataset", query.Dataset)
+	}
+
+	return s.baseUrl("/?" + values.Encode())
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"testing"
+
+	"sean.mcgivern.me.uk/cricket-query/cricket"
+)
+
+func TestTimedOut(t *testing.T) {
+	cases := []struct {
+		messages []string
+		expected bool
+	}{
+		{[]string{}, false},
+		{[]string{"Too many rows returned; stopping at 100"}, false},
+		{[]string{"interrupted (9)"}, true},
+		{[]string{"context deadline exceeded"}, true},
+	}
+
+	for _, c := range cases {
+		if timedOut(cricket.Result{Messages: c.messages}) != c.expected {
+			t.Errorf("timedOut(%v) == %v, want %v", c.messages, timedOut(cricket.Result{Messages: c.messages}), c.expected)
+		}
+	}
+}
@@ -1,12 +1,13 @@
 module sean.mcgivern.me.uk/cricket-query
 
-go 1.18
+go 1.21
 
 require (
+	github.com/BurntSushi/toml v1.3.2
 	github.com/google/go-cmp v0.5.9
 	github.com/jmoiron/sqlx v1.3.5
 	golang.org/x/text v0.9.0
-	modernc.org/sqlite v1.23.0
+	modernc.org/sqlite v1.24.0
 )
 
 require (
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"sean.mcgivern.me.uk/cricket-query/cricket"
+)
+
+type Readiness struct {
+	Status   string   `json:"status"`
+	Problems []string `json:"problems,omitempty"`
+}
+
+func (s *Server) healthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	io.WriteString(w, "ok\n")
+}
+
+func (s *Server) readyz(w http.ResponseWriter, r *http.Request) {
+	readiness := Readiness{Status: "ok"}
+
+	for _, dataset := range s.engine.Datasets {
+		// Every name in Datasets is mounted, so this can't fail.
+		db, done, _ := s.engine.UseDatabase(dataset.Name)
+
+		for _, problem := range db.Check(r.Context()) {
+			// Problems with other datasets say which one they're in.
+			if dataset.Name != cricket.DefaultDataset {
+				problem = dataset.Name + ": " + problem
+			}
+
+			readiness.Problems = append(readiness.Problems, problem)
+		}
+
+		done()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if len(readiness.Problems) > 0 {
+		readiness.Status = "unavailable"
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	json.NewEncoder(w).Encode(readiness)
+}
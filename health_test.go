@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/jmoiron/sqlx"
+	"sean.mcgivern.me.uk/cricket-query/cricket"
+)
+
+func TestHealthz(t *testing.T) {
+	w := httptest.NewRecorder()
+	testServer.healthz(w, httptest.NewRequest("GET", testServer.baseUrl("/healthz"), nil))
+
+	if w.Code != 200 || w.Body.String() != "ok\n" {
+		t.Errorf("healthz() == %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	full, done, _ := testEngine.UseDatabase(cricket.DefaultDataset)
+	done()
+
+	// A database that create-db stopped building part of the way through.
+	path := filepath.Join(t.TempDir(), "innings.sqlite3")
+	partial := sqlx.MustConnect("sqlite", path)
+	partial.MustExec("CREATE TABLE men_test_batting_innings (runs integer); CREATE TABLE men_test_bowling_innings (wickets integer); INSERT INTO men_test_bowling_innings VALUES (1);")
+	partial.Close()
+
+	problems := []string{"men_test_batting_innings: no rows"}
+
+	for _, table := range cricket.Tables()[2:] {
+		problems = append(problems, table+": SQL logic error: no such table: "+table+" (1)")
+	}
+
+	cases := []struct {
+		db       *cricket.Database
+		status   int
+		expected Readiness
+	}{
+		{full, 200, Readiness{Status: "ok"}},
+		{cricket.MustOpen(path), 503, Readiness{Status: "unavailable", Problems: problems}},
+	}
+
+	for _, c := range cases {
+		var readiness Readiness
+
+		s := newServer(defaultConfig(), newEngine(c.db, defaultConfig()), nil)
+		w := httptest.NewRecorder()
+		s.readyz(w, httptest.NewRequest("GET", testServer.baseUrl("/readyz"), nil))
+
+		if w.Code != c.status {
+			t.Errorf("readyz() == %d, want %d", w.Code, c.status)
+		}
+
+		if err := json.Unmarshal(w.Body.Bytes(), &readiness); err != nil {
+			t.Errorf("readyz() returned invalid JSON: %v", err)
+		}
+
+		if diff := cmp.Diff(c.expected, readiness); diff != "" {
+			t.Errorf("readyz() mismatch (-expected +result):\n%s", diff)
+		}
+	}
+}
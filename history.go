@@ -0,0 +1,51 @@
+package main
+
+import "sean.mcgivern.me.uk/cricket-query/cricket"
+
+// HistoryEntry describes a query that was just run. It's rendered into the
+// page as JSON, and static/history.js keeps the most recent entries in the
+// browser's local storage; the server doesn't store any history itself.
+type HistoryEntry struct {
+	SQL         string          `json:"sql"`
+	Formats     []string        `json:"formats"`
+	Genders     []string        `json:"genders"`
+	Subtitle    string          `json:"subtitle,omitempty"`
+	Dataset     string          `json:"dataset,omitempty"`
+	Projections []HistoryResult `json:"projections"`
+}
+
+type HistoryResult struct {
+	Id        string `json:"id"`
+	Header    string `json:"header"`
+	Duration  int64  `json:"duration"`
+	Rows      int    `json:"rows"`
+	Truncated bool   `json:"truncated"`
+	Failed    bool   `json:"failed"`
+}
+
+func newHistoryEntry(query cricket.Query, labelledResults []cricket.LabelledResult) HistoryEntry {
+	entry := HistoryEntry{
+		SQL:         query.SQL,
+		Formats:     cricket.CheckedValues(query.Formats),
+		Genders:     cricket.CheckedValues(query.Genders),
+		Subtitle:    query.Subtitle,
+		Projections: make([]HistoryResult, 0, len(labelledResults)),
+	}
+
+	if query.Dataset != cricket.DefaultDataset {
+		entry.Dataset = query.Dataset
+	}
+
+	for _, lr := range labelledResults {
+		entry.Projections = append(entry.Projections, HistoryResult{
+			Id:        lr.Id,
+			Header:    lr.Header,
+			Duration:  lr.Result.Duration.Milliseconds(),
+			Rows:      len(lr.Result.Rows),
+			Truncated: lr.Result.Truncated,
+			Failed:    lr.Result.Columns == nil,
+		})
+	}
+
+	return entry
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"sean.mcgivern.me.uk/cricket-query/cricket"
+)
+
+func TestNewHistoryEntry(t *testing.T) {
+	query := cricket.Query{
+		SQL:      "SELECT 1;",
+		Formats:  cricket.CheckboxValues(cricket.FormatValues, []string{"odi"}),
+		Genders:  cricket.CheckboxValues(cricket.GenderValues, []string{}),
+		Subtitle: "One",
+	}
+	labelledResults := []cricket.LabelledResult{
+		{Header: "Men's ODI", Id: "men-odi", Result: cricket.Result{
+			Columns:   []string{"1"},
+			Rows:      makeSingleRow(int64(1)),
+			Messages:  []string{"Too many rows returned; stopping at 1"},
+			Duration:  25 * time.Millisecond,
+			Truncated: true,
+		}},
+		{Header: "Women's ODI", Id: "women-odi", Result: cricket.Result{
+			Messages: []string{"interrupted (9)"},
+			Duration: 5 * time.Second,
+		}},
+	}
+	expected := HistoryEntry{
+		SQL:      "SELECT 1;",
+		Formats:  []string{"odi"},
+		Genders:  []string{"men", "women"},
+		Subtitle: "One",
+		Projections: []HistoryResult{
+			HistoryResult{"men-odi", "Men's ODI", 25, 1, true, false},
+			HistoryResult{"women-odi", "Women's ODI", 5000, 0, false, true},
+		},
+	}
+
+	if diff := cmp.Diff(expected, newHistoryEntry(query, labelledResults)); diff != "" {
+		t.Errorf("newHistoryEntry(%v, %v) mismatch (-expected +result):\n%s", query, labelledResults, diff)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"sean.mcgivern.me.uk/cricket-query/cricket"
+)
+
+func parseNetworks(values []string) (out []*net.IPNet, err error) {
+	for _, value := range values {
+		cidr := value
+
+		if ip := net.ParseIP(value); ip != nil && ip.To4() != nil {
+			cidr += "/32"
+		} else if ip != nil {
+			cidr += "/128"
+		}
+
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("trusted_proxies: %q is not an IP address or CIDR range", value)
+		}
+
+		out = append(out, network)
+	}
+
+	return
+}
+
+func trusted(ip net.IP, networks []*net.IPNet) bool {
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// clientIP returns the address of the client that made the request. If the
+// connection comes from a trusted proxy, X-Forwarded-For is read from the
+// right, skipping other trusted proxies, as anything further left could
+// have been set by the client.
+func clientIP(r *http.Request, proxies []*net.IPNet) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	ip := net.ParseIP(host)
+
+	if ip == nil || !trusted(ip, proxies) {
+		return host
+	}
+
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(forwarded[i]))
+
+		if hop == nil {
+			break
+		}
+
+		ip = hop
+
+		if !trusted(hop, proxies) {
+			break
+		}
+	}
+
+	return ip.String()
+}
+
+// withClientIP records the client for the rate limit, with a single charge
+// for the whole request.
+func withClientIP(handler http.Handler, proxies []*net.IPNet) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.ServeHTTP(w, r.WithContext(cricket.WithClient(r.Context(), clientIP(r, proxies))))
+	})
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"sean.mcgivern.me.uk/cricket-query/cricket"
+)
+
+func TestRateLimitedPage(t *testing.T) {
+	db, done, _ := testEngine.UseDatabase(cricket.DefaultDataset)
+	defer done()
+
+	c := defaultConfig()
+	c.RateBurst = 1
+	s := newServer(c, newEngine(db, c), nil)
+	url := s.baseUrl("/?sql=SELECT+1%3B&format=test&format=odi&format=t20i&gender=men&gender=women")
+
+	limited := "Server busy: you have run a lot of queries recently."
+
+	// The first request runs a query for each of the six projections.
+	for i, expected := range []bool{false, true} {
+		w := httptest.NewRecorder()
+		s.handler().ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+
+		if strings.Contains(w.Body.String(), limited) != expected {
+			t.Errorf("request %d rate limited == %v, want %v:\n%s", i+1, !expected, expected, w.Body.String())
+		}
+	}
+}
+
+func TestParseNetworks(t *testing.T) {
+	networks, err := parseNetworks([]string{"10.0.0.0/8", "192.0.2.1", "2001:db8::1"})
+
+	if err != nil || len(networks) != 3 || networks[1].String() != "192.0.2.1/32" || networks[2].String() != "2001:db8::1/128" {
+		t.Errorf("parseNetworks() == %v, %v", networks, err)
+	}
+
+	if _, err := parseNetworks([]string{"proxy.example.com"}); err == nil {
+		t.Errorf("parseNetworks() did not return an error for a host name")
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	proxies, _ := parseNetworks([]string{"10.0.0.0/8"})
+
+	cases := []struct {
+		remoteAddr string
+		forwarded  []string
+		expected   string
+	}{
+		{"192.0.2.1:1234", []string{}, "192.0.2.1"},
+		{"192.0.2.1:1234", []string{"198.51.100.1"}, "192.0.2.1"},
+		{"10.0.0.1:1234", []string{}, "10.0.0.1"},
+		{"10.0.0.1:1234", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"10.0.0.1:1234", []string{"203.0.113.1, 198.51.100.1"}, "198.51.100.1"},
+		{"10.0.0.1:1234", []string{"203.0.113.1, 198.51.100.1, 10.0.0.2"}, "198.51.100.1"},
+		{"10.0.0.1:1234", []string{"203.0.113.1", "198.51.100.1"}, "198.51.100.1"},
+		{"10.0.0.1:1234", []string{"10.0.0.3, 10.0.0.2"}, "10.0.0.3"},
+		{"10.0.0.1:1234", []string{"garbage"}, "10.0.0.1"},
+		{"[2001:db8::1]:1234", []string{"198.51.100.1"}, "2001:db8::1"},
+	}
+
+	for _, c := range cases {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = c.remoteAddr
+
+		for _, value := range c.forwarded {
+			r.Header.Add("X-Forwarded-For", value)
+		}
+
+		if clientIP(r, proxies) != c.expected {
+			t.Errorf("clientIP(%q, %q) == %v, want %v", c.remoteAddr, c.forwarded, clientIP(r, proxies), c.expected)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+
+	"sean.mcgivern.me.uk/cricket-query/cricket"
+)
+
+var logLevels = []string{"debug", "info", "warn", "error"}
+
+var logger = newLogger(os.Stderr, "info", "json")
+
+// logLevel returns the slog level called name, and whether it's one of
+// logLevels.
+func logLevel(name string) (slog.Level, bool) {
+	var level slog.Level
+
+	return level, inArray(name, logLevels) && level.UnmarshalText([]byte(name)) == nil
+}
+
+// logAttr writes times in UTC and levels in lower case, as in the
+// configuration.
+func logAttr(groups []string, attr slog.Attr) slog.Attr {
+	switch {
+	case len(groups) > 0:
+	case attr.Key == slog.TimeKey:
+		attr.Value = slog.TimeValue(attr.Value.Time().UTC())
+	case attr.Key == slog.LevelKey:
+		attr.Value = slog.StringValue(strings.ToLower(attr.Value.String()))
+	}
+
+	return attr
+}
+
+// newLogger logs lines at level and above to out, as JSON objects or, with
+// the text format, key=value pairs.
+func newLogger(out io.Writer, level string, format string) *slog.Logger {
+	minimum, _ := logLevel(level)
+	options := &slog.HandlerOptions{Level: minimum, ReplaceAttr: logAttr}
+
+	if format == "text" {
+		return slog.New(slog.NewTextHandler(out, options))
+	}
+
+	return slog.New(slog.NewJSONHandler(out, options))
+}
+
+func newRequestID() string {
+	id := make([]byte, 8)
+	rand.Read(id)
+
+	return hex.EncodeToString(id)
+}
+
+// withRequestID gives every request an ID, which is returned in the
+// X-Request-Id header and included in everything logged for the request.
+func withRequestID(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := newRequestID()
+
+		w.Header().Set("X-Request-Id", id)
+		handler.ServeHTTP(w, r.WithContext(cricket.WithRequestID(r.Context(), id)))
+	})
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"regexp"
+	"testing"
+)
+
+func TestLogger(t *testing.T) {
+	cases := []struct {
+		level    string
+		format   string
+		expected string
+	}{
+		{
+			"info",
+			"json",
+			`{"time":"T","level":"info","msg":"query","sql":"SELECT 1","rows":1,"truncated":false}
+{"time":"T","level":"warn","msg":"failed","error":"no such table"}
+`,
+		},
+		{
+			"warn",
+			"text",
+			`time=T level=warn msg=failed error="no such table"
+`,
+		},
+		{
+			"error",
+			"json",
+			"",
+		},
+	}
+
+	// Times are in UTC, so they all end in Z.
+	matchTime := regexp.MustCompile(`\d{4}-\d\d-\d\dT[\d:.]+Z`)
+
+	for _, c := range cases {
+		var out bytes.Buffer
+
+		l := newLogger(&out, c.level, c.format)
+		l.Debug("ignored")
+		l.Info("query", "sql", "SELECT 1", "rows", 1, "truncated", false)
+		l.Warn("failed", "error", errors.New("no such table"))
+
+		if result := matchTime.ReplaceAllString(out.String(), "T"); result != c.expected {
+			t.Errorf("newLogger(%q, %q) wrote:\n%s\nwant:\n%s", c.level, c.format, out.String(), c.expected)
+		}
+	}
+}
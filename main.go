@@ -2,79 +2,36 @@ package main
 
 import (
 	"context"
-	"database/sql/driver"
 	"embed"
+	"flag"
 	"fmt"
-	"github.com/jmoiron/sqlx"
-	"golang.org/x/text/language"
-	"golang.org/x/text/message"
 	"html/template"
 	"log"
-	sqlite3 "modernc.org/sqlite"
 	"net/http"
 	"os"
+	"os/signal"
 	"regexp"
-	"sort"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
+
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+	"sean.mcgivern.me.uk/cricket-query/cricket"
 )
 
 var (
-	db *sqlx.DB
 	//go:embed all:template
 	templatesFS embed.FS
 )
 
-type Query struct {
-	Formats     []Checkbox
-	Genders     []Checkbox
-	SQL         string
-	Subtitle    string
-	Description string
-}
-
-type Result struct {
-	Columns  []string
-	Rows     [][]any
-	Messages []string
-	Duration time.Duration
-}
-
-type LabelledResult struct {
-	Header string
-	Id     string
-	Result Result
-}
-
 type Page struct {
 	Title   string
-	Query   Query
+	Query   cricket.Query
 	Content any
 }
 
-type Checkbox struct {
-	Label   string
-	Value   string
-	Checked bool
-}
-
-var rowsLimit = 100
-var defaultTimeout = 5000
-
-var formatValues = []Checkbox{
-	Checkbox{"Test", "test", false},
-	Checkbox{"ODI", "odi", false},
-	Checkbox{"T20I", "t20i", false},
-}
-
-var genderValues = []Checkbox{
-	Checkbox{"Men", "men", false},
-	Checkbox{"Women", "women", false},
-}
-
-var startsWithWith = regexp.MustCompile(`(?i)\AWITH`)
-
 var matchLink = regexp.MustCompile(`\A[mp]\d+\z`)
 var matchDate = regexp.MustCompile(`\A\d{4}-\d{2}-\d{2}( 00:00:00 \+0000 UTC)?\z`)
 var matchInteger = regexp.MustCompile(`\A-?\d+\z`)
@@ -83,58 +40,6 @@ var matchFloat = regexp.MustCompile(`\A-?\d+\.\d+\z`)
 var playerPrefix = "https://www.espncricinfo.com/ci/content/player/"
 var matchPrefix = "https://www.espncricinfo.com/ci/content/match/"
 
-type medianFunction struct {
-	vals []float64
-}
-
-func (f *medianFunction) Step(ctx *sqlite3.FunctionContext, args []driver.Value) error {
-	switch resTyped := args[0].(type) {
-	case int64:
-		f.vals = append(f.vals, float64(resTyped))
-	case float64:
-		f.vals = append(f.vals, resTyped)
-	case nil:
-	default:
-		return fmt.Errorf("value is not a number: %T", resTyped)
-	}
-	return nil
-}
-
-func (f *medianFunction) WindowInverse(ctx *sqlite3.FunctionContext, args []driver.Value) error {
-	first, rest := f.vals[0], f.vals[1:]
-
-	switch resTyped := args[0].(type) {
-	case int64:
-		if first == float64(resTyped) {
-			f.vals = rest
-		}
-	case float64:
-		if first == resTyped {
-			f.vals = rest
-		}
-	case nil:
-	default:
-		return fmt.Errorf("value is not a number: %T", resTyped)
-	}
-	return nil
-}
-
-func (f *medianFunction) WindowValue(ctx *sqlite3.FunctionContext) (driver.Value, error) {
-	l := len(f.vals)
-
-	sort.Float64s(f.vals)
-
-	if l == 0 {
-		return int64(0), nil
-	} else if l%2 == 0 {
-		return (f.vals[l/2-1] + f.vals[l/2]) / 2, nil
-	} else {
-		return f.vals[l/2], nil
-	}
-}
-
-func (f *medianFunction) Final(ctx *sqlite3.FunctionContext) {}
-
 func escape(s string) template.HTML {
 	return template.HTML(template.HTMLEscapeString(s))
 }
@@ -193,92 +98,47 @@ func format(value any) template.HTML {
 	return escape(text)
 }
 
-func baseUrl(url string) string {
-	rootLeadingSlash := "/cricket-query"
-	rootDoubleSlash := "/cricket-query/"
-
-	if strings.HasPrefix(url, "/") && !strings.HasPrefix(url, rootDoubleSlash) {
-		return fmt.Sprintf("%s%s", rootLeadingSlash, url)
-	} else {
-		return url
-	}
-}
+// sortValue returns the raw value behind a formatted cell, so that tables can
+// be re-sorted in the browser: numbers without separators and dates as ISO
+// strings.
+func sortValue(value any) string {
+	text := fmt.Sprint(value)
+	bytes := []byte(text)
 
-func projectQuery(ctx context.Context, query Query, limit int, timeout int) (out []LabelledResult) {
-	for _, format := range query.Formats {
-		for _, gender := range query.Genders {
-			if format.Checked && gender.Checked {
-				out = append(out, LabelledResult{
-					fmt.Sprintf("%s's %s", gender.Label, format.Label),
-					fmt.Sprintf("%s-%s", gender.Value, format.Value),
-					runQuery(ctx, addAliases(gender.Value, format.Value, query.SQL), limit, timeout),
-				})
-			}
-		}
+	if value == nil {
+		return ""
+	} else if strings.HasPrefix(text, "'") {
+		return strings.TrimPrefix(text, "'")
+	} else if matchDate.Match(bytes) {
+		return text[0:10]
 	}
 
-	return
+	return text
 }
 
-func runQuery(ctx context.Context, sql string, limit int, timeout int) Result {
-	messages := make([]string, 0)
-	rows := make([][]any, 0)
-	i := 1
-	start := time.Now()
-	ctx, cancel := context.WithTimeout(ctx, time.Duration(timeout)*time.Millisecond)
-	defer cancel()
-
-	results, err := db.QueryxContext(ctx, sql)
-	elapsed := time.Now().Sub(start)
-
-	if err == nil {
-		err = ctx.Err()
-	}
-
-	if err != nil {
-		return Result{Messages: []string{err.Error()}, Duration: elapsed}
-	}
-
-	columns, err := results.Columns()
-	if err != nil {
-		messages = append(messages, err.Error())
-	}
-
-	for results.Next() {
-		if i > limit {
-			messages = append(messages, fmt.Sprintf("Too many rows returned; stopping at %d", limit))
-			break
-		}
-
-		cols, err := results.SliceScan()
-		if err != nil {
-			messages = append(messages, err.Error())
-		}
+// format is format, except that player and match IDs link to our own
+// pages when internal_links is set.
+func (s *Server) format(value any) template.HTML {
+	text := fmt.Sprint(value)
 
-		rows = append(rows, cols)
-		i += 1
+	if s.config.InternalLinks && matchPlayerId.MatchString(text) {
+		return template.HTML(fmt.Sprintf(`<a href="%s">%s</a>`, s.playerUrl(text, ""), text))
+	} else if s.config.InternalLinks && matchMatchId.MatchString(text) {
+		return template.HTML(fmt.Sprintf(`<a href="%s">%s</a>`, s.matchUrl(text, ""), text))
 	}
 
-	return Result{
-		Columns:  columns,
-		Rows:     rows,
-		Messages: messages,
-		Duration: elapsed,
-	}
+	return format(value)
 }
 
-func addAliases(gender string, format string, sql string) string {
-	if startsWithWith.Match([]byte(sql)) {
-		sql = startsWithWith.ReplaceAllString(sql, ",")
-	}
+func (s *Server) baseUrl(url string) string {
+	rootLeadingSlash := s.config.BasePath
+	rootDoubleSlash := s.config.BasePath + "/"
 
-	return fmt.Sprintf(`
-WITH
-innings AS (SELECT * FROM %[1]s_%[2]s_batting_innings),
-bowling_innings AS (SELECT * FROM %[1]s_%[2]s_bowling_innings),
-team_innings AS (SELECT * FROM %[1]s_%[2]s_team_innings)
-%[3]s
-`, gender, format, sql)
+	if strings.HasPrefix(url, "/") && !strings.HasPrefix(url, rootDoubleSlash) {
+		return fmt.Sprintf("%s%s", rootLeadingSlash, url)
+	} else {
+		return url
+	}
 }
 
 func inArray(needle string, haystack []string) bool {
@@ -291,61 +151,110 @@ func inArray(needle string, haystack []string) bool {
 	return false
 }
 
-func checkboxValues(checkboxes []Checkbox, checked []string) (out []Checkbox) {
-	for _, checkbox := range checkboxes {
-		out = append(
-			out,
-			Checkbox{
-				checkbox.Label,
-				checkbox.Value,
-				len(checked) == 0 || inArray(checkbox.Value, checked),
-			},
-		)
-	}
-
-	return
-}
-
-func index(w http.ResponseWriter, r *http.Request) {
-	var query Query
+func (s *Server) index(w http.ResponseWriter, r *http.Request) {
+	var query cricket.Query
 	var ok bool
 
 	r.ParseForm()
 
 	savedQuery := r.FormValue("query")
 
-	if query, ok = savedQueries[savedQuery]; !ok {
-		query = Query{
+	if query, ok = s.engine.SavedQueries[savedQuery]; ok {
+		savedQueriesTotal.inc(savedQuery)
+		r = r.WithContext(cricket.WithSavedQuery(r.Context(), savedQuery))
+
+		// A saved query can be pinned to a dataset; otherwise it runs
+		// against the one chosen on the page.
+		if query.Dataset == "" {
+			query.Dataset = r.FormValue("dataset")
+		}
+	} else {
+		query = cricket.Query{
 			SQL:     r.FormValue("sql"),
-			Formats: checkboxValues(formatValues, r.Form["format"]),
-			Genders: checkboxValues(genderValues, r.Form["gender"]),
+			Formats: cricket.CheckboxValues(cricket.FormatValues, r.Form["format"]),
+			Genders: cricket.CheckboxValues(cricket.GenderValues, r.Form["gender"]),
+			Dataset: r.FormValue("dataset"),
 		}
 	}
 
+	s.showQuery(w, r, query)
+}
+
+func (s *Server) showQuery(w http.ResponseWriter, r *http.Request, query cricket.Query) {
 	if query.SQL == "" {
 		query.SQL = "SELECT * FROM innings ORDER BY runs DESC LIMIT 10;"
 	}
 
-	executeTemplate(w, "index.html", Page{
+	var labelledResults []cricket.LabelledResult
+	var labelledPlans []cricket.LabelledPlan
+	var labelledDiffs []cricket.LabelledDiff
+
+	dataset, ok := s.requestDataset(w, r, query.Dataset)
+	if !ok {
+		return
+	}
+
+	compare, ok := s.requestDataset(w, r, r.FormValue("compare"))
+	if !ok {
+		return
+	}
+
+	query.Dataset = dataset.Name
+	ctx := cricket.WithDataset(r.Context(), dataset.Name)
+	key := strings.TrimSpace(r.FormValue("key"))
+
+	// Comparing a dataset with itself shows nothing, so default to the
+	// first other one.
+	for _, other := range s.engine.Datasets {
+		if compare.Name != dataset.Name {
+			break
+		}
+
+		compare = other
+	}
+
+	if r.FormValue("explain") != "" {
+		labelledPlans = s.engine.ProjectExplain(ctx, query, s.engine.Timeout)
+	} else if r.FormValue("diff") != "" {
+		labelledDiffs = s.engine.ProjectDiff(ctx, query, compare.Name, dataset.Name, key, s.engine.DiffRowsLimit, s.engine.Timeout)
+	} else {
+		labelledResults = s.engine.ProjectQuery(ctx, query, s.engine.RowsLimit, s.engine.Timeout)
+	}
+
+	s.executeTemplate(w, "index.html", Page{
 		Title: "Cricket query",
 		Query: query,
 		Content: struct {
-			LabelledResults []LabelledResult
+			LabelledResults []cricket.LabelledResult
+			LabelledPlans   []cricket.LabelledPlan
+			LabelledDiffs   []cricket.LabelledDiff
+			History         HistoryEntry
+			Datasets        []cricket.Dataset
+			Dataset         cricket.Dataset
+			Compare         cricket.Dataset
+			Key             string
 		}{
-			projectQuery(r.Context(), query, rowsLimit, defaultTimeout),
+			labelledResults,
+			labelledPlans,
+			labelledDiffs,
+			newHistoryEntry(query, labelledResults),
+			s.engine.Datasets,
+			dataset,
+			compare,
+			key,
 		},
 	})
 }
 
-func help(w http.ResponseWriter, r *http.Request) {
-	executeTemplate(w, "help.html", Page{
+func (s *Server) help(w http.ResponseWriter, r *http.Request) {
+	s.executeTemplate(w, "help.html", Page{
 		Title: "Cricket query help",
 		Content: struct {
-			SavedQueries map[string]Query
-			Latest       Result
+			SavedQueries map[string]cricket.Query
+			Latest       cricket.Result
 		}{
-			savedQueries,
-			runQuery(
+			s.engine.SavedQueries,
+			s.engine.RunQuery(
 				r.Context(),
 				`
 SELECT gender, format, team, opposition, ground, start_date, match_id FROM (
@@ -362,19 +271,31 @@ SELECT gender, format, team, opposition, ground, start_date, match_id FROM (
   SELECT * FROM (SELECT 6 AS sort, 'women' AS gender, 't20i' AS format, team, opposition, ground, start_date, match_id FROM women_t20i_team_innings ORDER BY start_date DESC, i DESC LIMIT 1)
 ) ORDER BY sort ASC;`,
 				10,
-				defaultTimeout,
+				s.engine.Timeout,
 			),
 		},
 	})
 }
 
-func executeTemplate(w http.ResponseWriter, path string, page Page) {
+func (s *Server) executeTemplate(w http.ResponseWriter, path string, page Page) {
 	template.Must(
 		template.
 			New("").
 			Funcs(template.FuncMap{
-				"format":  format,
-				"baseUrl": baseUrl,
+				"format":       s.format,
+				"sortValue":    sortValue,
+				"baseUrl":      s.baseUrl,
+				"static":       s.staticUrl,
+				"hasStatic":    hasStatic,
+				"timedOut":     timedOut,
+				"explainUrl":   s.explainUrl,
+				"compareUrl":   s.compareUrl,
+				"checkUrl":     s.checkUrl,
+				"playerUrl":    s.playerUrl,
+				"milliseconds": milliseconds,
+				"config": func() Config {
+					return s.config
+				},
 				"formatDuration": func(duration time.Duration) string {
 					return fmt.Sprintf("%s", duration.Round(time.Millisecond))
 				},
@@ -383,33 +304,92 @@ func executeTemplate(w http.ResponseWriter, path string, page Page) {
 		ExecuteTemplate(w, path, page)
 }
 
-func logRequests(handler http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		log.Printf("%s %s %s\n", r.RemoteAddr, r.Method, r.URL)
-		handler.ServeHTTP(w, r)
-	})
-}
+func main() {
+	args := os.Args[1:]
 
-func init() {
-	sqlite3.MustRegisterFunction("median", &sqlite3.FunctionImpl{
-		NArgs:         1,
-		Deterministic: true,
-		MakeAggregate: func(ctx sqlite3.FunctionContext) (sqlite3.AggregateFunction, error) {
-			return &medianFunction{}, nil
-		},
-	})
-}
+	// `cricket-query data-quality` takes the same flags, but runs the
+	// data-quality checks instead of serving.
+	dataQuality := len(args) > 0 && args[0] == "data-quality"
 
-func main() {
-	db = sqlx.MustConnect("sqlite", "data/innings.sqlite3")
-	port, exists := os.LookupEnv("PORT")
+	if dataQuality {
+		args = args[1:]
+	}
 
-	if !exists {
-		port = "8080"
+	config, printConfig, err := loadConfig(args, os.LookupEnv, os.Stderr)
+
+	if err == flag.ErrHelp {
+		os.Exit(0)
+	} else if err != nil {
+		log.Fatal(err)
+	} else if printConfig {
+		if err := config.print(os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+
+		os.Exit(0)
 	}
 
-	http.HandleFunc(baseUrl("/"), index)
-	http.HandleFunc(baseUrl("/help/"), help)
+	logger = newLogger(os.Stderr, config.LogLevel, config.LogFormat)
+	engine := newEngine(cricket.MustOpen(config.Database), config)
+
+	for _, dataset := range config.Datasets {
+		engine.Mount(dataset, cricket.MustOpen(dataset.Path))
+	}
+
+	if dataQuality {
+		if engine.writeDataQuality(os.Stdout) {
+			os.Exit(1)
+		}
+
+		os.Exit(0)
+	}
+
+	app := newServer(config, engine, connectStore(config.Permalinks))
+
+	for _, dataset := range engine.Datasets {
+		db, done, _ := engine.UseDatabase(dataset.Name)
+
+		if problems := db.Check(context.Background()); len(problems) > 0 {
+			logger.Error("database is not ready", "dataset", dataset.Name, "database", dataset.Path, "problems", problems)
+		}
+
+		done()
+		engine.refreshQuality(dataset.Name)
+	}
+
+	queriesCtx, cancelQueries := context.WithCancel(context.Background())
+	server := app.httpServer(queriesCtx)
+	signals := make(chan os.Signal, 1)
+
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+
+	go func() {
+		logger.Info("listening", "address", server.Addr)
+
+		if err := server.ListenAndServe(); err != http.ErrServerClosed {
+			logger.Error("server failed", "error", err)
+			os.Exit(1)
+		}
+	}()
+
+	for received := range signals {
+		logger.Info("received signal", "signal", received.String())
+
+		if received != syscall.SIGHUP {
+			break
+		}
+
+		// SIGHUP reloads the databases, for after scripts/create-db has
+		// replaced one.
+		for _, dataset := range engine.Datasets {
+			if err := engine.Reload(dataset.Name, dataset.Path, milliseconds(config.ShutdownTimeout)); err != nil {
+				logger.Error("reload failed; still using the old database", "dataset", dataset.Name, "error", err)
+			} else {
+				logger.Info("reloaded database", "dataset", dataset.Name, "database", dataset.Path)
+				engine.refreshQuality(dataset.Name)
+			}
+		}
+	}
 
-	log.Fatal(http.ListenAndServe(fmt.Sprintf("localhost:%s", port), logRequests(http.DefaultServeMux)))
+	shutdown(server, engine, cancelQueries, milliseconds(config.ShutdownTimeout))
 }
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"sean.mcgivern.me.uk/cricket-query/cricket"
+)
+
+var matchMatchId = regexp.MustCompile(`\Am\d+\z`)
+
+var errNoMatch = errors.New("no such match")
+
+// ScorecardInnings is one team's innings: their total from the team table,
+// and the batting and bowling rows with the same innings number.
+type ScorecardInnings struct {
+	Innings  int64  `db:"innings"`
+	Team     string `db:"team"`
+	Score    string `db:"score"`
+	Overs    string `db:"overs"`
+	AllOut   bool   `db:"all_out"`
+	Declared bool   `db:"declared"`
+	Result   string `db:"result"`
+	Batting  cricket.Result
+	Bowling  cricket.Result
+}
+
+// Scorecard is a match rebuilt from the three tables for its projection.
+type Scorecard struct {
+	Id        string
+	Header    string
+	Ground    string
+	StartDate string
+	Result    string
+	Innings   []ScorecardInnings
+	Messages  []string
+}
+
+// findMatch returns the gender and format of the projection that has the
+// match in any of its tables.
+func (e *Engine) findMatch(ctx context.Context, id string) (gender cricket.Checkbox, format cricket.Checkbox, err error) {
+	var parts []string
+	var found []string
+
+	for _, table := range cricket.Tables() {
+		parts = append(parts, fmt.Sprintf("SELECT '%s' FROM %s WHERE match_id = ?1", table, table))
+	}
+
+	if err = e.SelectRows(ctx, "match", &found, strings.Join(parts, "\nUNION ALL\n")+"\nLIMIT 1;", id); err != nil {
+		return
+	}
+
+	if len(found) == 0 {
+		return gender, format, errNoMatch
+	}
+
+	for _, gender = range cricket.GenderValues {
+		for _, format = range cricket.FormatValues {
+			if strings.HasPrefix(found[0], fmt.Sprintf("%s_%s_", gender.Value, format.Value)) {
+				return
+			}
+		}
+	}
+
+	return gender, format, errNoMatch
+}
+
+// splitInnings splits a result whose first column is the innings number
+// into a result for each innings, without that column.
+func splitInnings(result cricket.Result) map[int64]cricket.Result {
+	out := make(map[int64]cricket.Result)
+
+	for _, row := range result.Rows {
+		innings, _ := row[0].(int64)
+		split := out[innings]
+
+		if split.Columns == nil {
+			split = cricket.Result{Columns: result.Columns[1:], Rows: [][]any{}, Messages: []string{}}
+		}
+
+		split.Rows = append(split.Rows, row[1:])
+		out[innings] = split
+	}
+
+	return out
+}
+
+// matchResult describes the result from the team rows: the winner, if
+// there was one, and otherwise the first team's result.
+func matchResult(innings []ScorecardInnings) string {
+	for _, i := range innings {
+		if i.Result == "won" {
+			return i.Team + " won"
+		}
+	}
+
+	if len(innings) == 0 || innings[0].Result == "" {
+		return ""
+	}
+
+	return strings.ToUpper(innings[0].Result[:1]) + innings[0].Result[1:]
+}
+
+// loadScorecard rebuilds a match from the dataset in ctx. Batting and
+// bowling are one query each, split by innings afterwards, so that a
+// scorecard costs the same however many innings there were.
+func (e *Engine) loadScorecard(ctx context.Context, id string) (card Scorecard, err error) {
+	ctx, cancel := context.WithTimeout(ctx, milliseconds(e.Timeout))
+	defer cancel()
+
+	gender, format, err := e.findMatch(ctx, id)
+	if err != nil {
+		return
+	}
+
+	card.Id = id
+	card.Header = fmt.Sprintf("%s's %s", gender.Label, format.Label)
+
+	err = e.SelectRows(ctx, "match", &card.Innings, cricket.AddAliases(gender.Value, format.Value, `
+SELECT
+  innings,
+  team,
+  coalesce(score, '') AS score,
+  coalesce(CAST(overs AS text), '') AS overs,
+  coalesce(all_out = 'True', 0) AS all_out,
+  coalesce(declared = 'True', 0) AS declared,
+  coalesce(result, '') AS result
+FROM team_innings
+WHERE match_id = ?1
+ORDER BY innings;`), id)
+	if err != nil {
+		return
+	}
+
+	var header []struct {
+		Ground    string `db:"ground"`
+		StartDate string `db:"start_date"`
+	}
+
+	err = e.SelectRows(ctx, "match", &header, cricket.AddAliases(gender.Value, format.Value, `
+SELECT ground, substr(start_date, 1, 10) AS start_date
+FROM (
+  SELECT ground, start_date FROM team_innings WHERE match_id = ?1
+  UNION ALL
+  SELECT ground, start_date FROM innings WHERE match_id = ?1
+)
+LIMIT 1;`), id)
+	if err != nil {
+		return
+	}
+
+	if len(header) > 0 {
+		card.Ground = header[0].Ground
+		card.StartDate = header[0].StartDate
+	}
+
+	batting := e.RunQuery(ctx, cricket.AddAliases(gender.Value, format.Value, fmt.Sprintf(`
+SELECT innings, pos, player, player_id, runs_txt AS runs, bf AS balls, mins, fours, sixes, sr AS strike_rate
+FROM innings
+WHERE match_id = %s
+ORDER BY innings, pos;`, sqlString(id))), e.RowsLimit, e.Timeout)
+
+	bowling := e.RunQuery(ctx, cricket.AddAliases(gender.Value, format.Value, fmt.Sprintf(`
+SELECT innings, player, player_id, '''' || overs AS overs, maidens, runs, wickets, economy
+FROM bowling_innings
+WHERE match_id = %s AND overs IS NOT NULL
+ORDER BY innings, pos;`, sqlString(id))), e.RowsLimit, e.Timeout)
+
+	card.Messages = append(batting.Messages, bowling.Messages...)
+	battingInnings := splitInnings(batting)
+	bowlingInnings := splitInnings(bowling)
+
+	for i := range card.Innings {
+		card.Innings[i].Batting = battingInnings[card.Innings[i].Innings]
+		card.Innings[i].Bowling = bowlingInnings[card.Innings[i].Innings]
+	}
+
+	card.Result = matchResult(card.Innings)
+
+	return
+}
+
+// Teams returns the teams in batting order: "Australia v England".
+func (c Scorecard) Teams() string {
+	var teams []string
+
+	for _, i := range c.Innings {
+		if !inArray(i.Team, teams) {
+			teams = append(teams, i.Team)
+		}
+	}
+
+	return strings.Join(teams, " v ")
+}
+
+// Total is the innings total as it's usually written: "245 all out (169.3
+// overs)", or "300/6 declared".
+func (i ScorecardInnings) Total() string {
+	total := i.Score
+
+	if i.AllOut {
+		total += " all out"
+	} else if i.Declared && !strings.HasSuffix(total, "d") {
+		total += " declared"
+	}
+
+	if i.Overs != "" {
+		total += fmt.Sprintf(" (%s overs)", i.Overs)
+	}
+
+	return total
+}
+
+// match shows the scorecard at /match/<id>.
+func (s *Server) match(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, s.baseUrl("/match/"))
+	if !matchMatchId.MatchString(id) {
+		http.NotFound(w, r)
+		return
+	}
+
+	dataset, ok := s.requestDataset(w, r, r.FormValue("dataset"))
+	if !ok {
+		return
+	}
+
+	card, err := s.engine.loadScorecard(cricket.WithDataset(r.Context(), dataset.Name), id)
+
+	if err == errNoMatch {
+		http.NotFound(w, r)
+		return
+	}
+
+	messages := append([]string{}, card.Messages...)
+	if err != nil {
+		messages = append(messages, err.Error())
+	}
+
+	title := fmt.Sprintf("%s scorecard", id)
+	if teams := card.Teams(); teams != "" {
+		title = teams
+	}
+
+	s.executeTemplate(w, "match.html", Page{
+		Title: title,
+		Content: struct {
+			Scorecard Scorecard
+			Messages  []string
+			Dataset   cricket.Dataset
+		}{
+			card,
+			messages,
+			dataset,
+		},
+	})
+}
+
+// matchUrl links to a match's scorecard, in the dataset if it isn't the
+// default.
+func (s *Server) matchUrl(id string, dataset string) string {
+	if dataset != "" && dataset != cricket.DefaultDataset {
+		return s.baseUrl("/match/" + id + "?" + url.Values{"dataset": []string{dataset}}.Encode())
+	}
+
+	return s.baseUrl("/match/" + id)
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"sean.mcgivern.me.uk/cricket-query/cricket"
+)
+
+func TestSplitInnings(t *testing.T) {
+	result := cricket.Result{
+		Columns: []string{"innings", "player", "runs"},
+		Rows:    [][]any{{int64(1), "A", int64(10)}, {int64(1), "B", int64(20)}, {int64(3), "A", int64(5)}},
+	}
+
+	expected := map[int64]cricket.Result{
+		1: {Columns: []string{"player", "runs"}, Rows: [][]any{{"A", int64(10)}, {"B", int64(20)}}, Messages: []string{}},
+		3: {Columns: []string{"player", "runs"}, Rows: [][]any{{"A", int64(5)}}, Messages: []string{}},
+	}
+
+	if diff := cmp.Diff(expected, splitInnings(result)); diff != "" {
+		t.Errorf("splitInnings() mismatch (-expected +result):\n%s", diff)
+	}
+}
+
+func TestMatchResult(t *testing.T) {
+	cases := []struct {
+		innings  []ScorecardInnings
+		expected string
+	}{
+		{[]ScorecardInnings{{Team: "Australia", Result: "lost"}, {Team: "England", Result: "won"}}, "England won"},
+		{[]ScorecardInnings{{Team: "Australia", Result: "draw"}, {Team: "England", Result: "draw"}}, "Draw"},
+		{[]ScorecardInnings{{Team: "Australia"}}, ""},
+		{nil, ""},
+	}
+
+	for _, c := range cases {
+		if result := matchResult(c.innings); result != c.expected {
+			t.Errorf("matchResult(%v) == %q, want %q", c.innings, result, c.expected)
+		}
+	}
+}
+
+func TestScorecardTotal(t *testing.T) {
+	cases := []struct {
+		innings  ScorecardInnings
+		expected string
+	}{
+		{ScorecardInnings{Score: "245", Overs: "169.3", AllOut: true}, "245 all out (169.3 overs)"},
+		{ScorecardInnings{Score: "300/6", Declared: true}, "300/6 declared"},
+		{ScorecardInnings{Score: "300/6d", Declared: true}, "300/6d"},
+		{ScorecardInnings{Score: "150/3", Overs: "20"}, "150/3 (20 overs)"},
+	}
+
+	for _, c := range cases {
+		if result := c.innings.Total(); result != c.expected {
+			t.Errorf("Total() for %v == %q, want %q", c.innings, result, c.expected)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	cases := []struct {
+		path     string
+		code     int
+		expected []string
+	}{
+		{
+			"/match/m62396",
+			200,
+			[]string{
+				"<h1>Australia v England</h1>",
+				"Men&#39;s Test, Melbourne, 15 March 1877.",
+				"<strong>Australia won</strong>",
+				`<h2 id="innings-1">Australia: 245 all out (169.3 overs)`,
+				`<h2 id="innings-4">England: 108 all out (66.1 overs)`,
+				`<td data-sort="165*">165*</td>`,
+				`<td data-sort="A Shaw">A Shaw</td>`,
+			},
+		},
+		{"/match/m1", 404, nil},
+		{"/match/62396", 404, nil},
+		{"/match/", 404, nil},
+	}
+
+	for _, c := range cases {
+		w := httptest.NewRecorder()
+		testServer.match(w, httptest.NewRequest("GET", testServer.baseUrl(c.path), nil))
+
+		if w.Code != c.code {
+			t.Errorf("match(%q) == %d, want %d", c.path, w.Code, c.code)
+		}
+
+		for _, expected := range c.expected {
+			if !strings.Contains(w.Body.String(), expected) {
+				t.Errorf("match(%q) did not contain %q:\n%s", c.path, expected, w.Body.String())
+			}
+		}
+	}
+
+	// Finding the match waits for a query slot like any other query.
+	live, done, _ := testEngine.UseDatabase(cricket.DefaultDataset)
+	done()
+
+	config := defaultConfig()
+	config.MaxQueries = 1
+	config.QueueTimeout = 1
+	busy := newServer(config, newEngine(cricket.MustOpen(live.Path), config), nil)
+
+	release, err := busy.engine.Limiter.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	busy.match(w, httptest.NewRequest("GET", busy.baseUrl("/match/m62396"), nil))
+	release()
+
+	if w.Code != 200 || !strings.Contains(w.Body.String(), "Server busy") {
+		t.Errorf("match(%q) with no free slots == %d:\n%s", "m62396", w.Code, w.Body.String())
+	}
+
+	// The snapshot has fewer batting rows for the same match.
+	s := snapshotServer(t)
+	w = httptest.NewRecorder()
+	s.match(w, httptest.NewRequest("GET", s.matchUrl("m62396", "snapshot"), nil))
+
+	if !strings.Contains(w.Body.String(), "<h1>Australia v England</h1>") || strings.Contains(w.Body.String(), "165*") {
+		t.Errorf("match(%q) on the snapshot:\n%s", "m62396", w.Body.String())
+	}
+}
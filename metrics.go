@@ -0,0 +1,216 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"sean.mcgivern.me.uk/cricket-query/cricket"
+)
+
+// Metric is a counter or histogram with labels, written in the Prometheus
+// text format. Each combination of label values is a separate series.
+type Metric struct {
+	Name    string
+	Help    string
+	Labels  []string
+	Buckets []float64
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+type series struct {
+	labels  []string
+	count   float64
+	sum     float64
+	buckets []float64
+}
+
+var durationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+var rowBuckets = []float64{0, 1, 5, 10, 25, 50, 100}
+
+var requestsTotal = newMetric("cricket_query_requests_total", "HTTP requests by handler and status code.", []string{"handler", "code"}, nil)
+var queryDuration = newMetric("cricket_query_query_duration_seconds", "Time taken by each query, by projection.", []string{"projection"}, durationBuckets)
+var queryRows = newMetric("cricket_query_query_rows", "Rows returned by each query, by projection.", []string{"projection"}, rowBuckets)
+var queryErrorsTotal = newMetric("cricket_query_query_errors_total", "Queries that returned an error, by type.", []string{"type"}, nil)
+var savedQueriesTotal = newMetric("cricket_query_saved_queries_total", "Runs of each saved query.", []string{"query"}, nil)
+
+var metricsRegistry = []*Metric{requestsTotal, queryDuration, queryRows, queryErrorsTotal, savedQueriesTotal}
+
+func newMetric(name string, help string, labels []string, buckets []float64) *Metric {
+	return &Metric{
+		Name:    name,
+		Help:    help,
+		Labels:  labels,
+		Buckets: buckets,
+		series:  make(map[string]*series),
+	}
+}
+
+func (m *Metric) get(labels []string) *series {
+	if len(labels) != len(m.Labels) {
+		panic(fmt.Sprintf("%s: got %d label values, want %d", m.Name, len(labels), len(m.Labels)))
+	}
+
+	key := strings.Join(labels, "\xff")
+	s, ok := m.series[key]
+
+	if !ok {
+		s = &series{labels: labels, buckets: make([]float64, len(m.Buckets))}
+		m.series[key] = s
+	}
+
+	return s
+}
+
+func (m *Metric) inc(labels ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.get(labels).count++
+}
+
+func (m *Metric) observe(value float64, labels ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s := m.get(labels)
+	s.count++
+	s.sum += value
+
+	for i, bucket := range m.Buckets {
+		if value <= bucket {
+			s.buckets[i]++
+		}
+	}
+}
+
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+func formatLabels(names []string, values []string, extra ...string) string {
+	var pairs []string
+
+	for i, name := range names {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, name, escapeLabel(values[i])))
+	}
+
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, extra[i], escapeLabel(extra[i+1])))
+	}
+
+	if len(pairs) == 0 {
+		return ""
+	}
+
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatValue(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+func (m *Metric) write(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	kind := "counter"
+	if m.Buckets != nil {
+		kind = "histogram"
+	}
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.Name, m.Help, m.Name, kind)
+
+	keys := make([]string, 0, len(m.series))
+	for key := range m.series {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		s := m.series[key]
+
+		if m.Buckets == nil {
+			fmt.Fprintf(w, "%s%s %s\n", m.Name, formatLabels(m.Labels, s.labels), formatValue(s.count))
+			continue
+		}
+
+		for i, bucket := range m.Buckets {
+			fmt.Fprintf(w, "%s_bucket%s %s\n", m.Name, formatLabels(m.Labels, s.labels, "le", formatValue(bucket)), formatValue(s.buckets[i]))
+		}
+
+		fmt.Fprintf(w, "%s_bucket%s %s\n", m.Name, formatLabels(m.Labels, s.labels, "le", "+Inf"), formatValue(s.count))
+		fmt.Fprintf(w, "%s_sum%s %s\n", m.Name, formatLabels(m.Labels, s.labels), formatValue(s.sum))
+		fmt.Fprintf(w, "%s_count%s %s\n", m.Name, formatLabels(m.Labels, s.labels), formatValue(s.count))
+	}
+}
+
+// observeQuery records how long a query took, and either the rows it
+// returned or the type of its error. Queries turned away by the limiter
+// never ran, so they only count as errors.
+func observeQuery(projection string, result cricket.Result) {
+	if len(result.Rows) == 0 && len(result.Messages) > 0 {
+		kind := cricket.ErrorType(result.Messages[0])
+		queryErrorsTotal.inc(kind)
+
+		if kind == "busy" || kind == "rate_limited" {
+			return
+		}
+	} else {
+		queryRows.observe(float64(len(result.Rows)), projection)
+	}
+
+	queryDuration.observe(result.Duration.Seconds(), projection)
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// instrument counts and logs the requests to a handler by response
+// status. Only the path is logged, as the query string can hold the SQL.
+func instrument(name string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		recorder := &statusRecorder{w, http.StatusOK}
+		start := time.Now()
+		client := cricket.Client(r.Context())
+
+		handler(recorder, r)
+		requestsTotal.inc(name, strconv.Itoa(recorder.status))
+		logger.Info(
+			"request",
+			"request_id", cricket.RequestID(r.Context()),
+			"handler", name,
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", recorder.status,
+			"duration_ms", time.Now().Sub(start).Milliseconds(),
+			"client", client,
+		)
+	}
+}
+
+func (s *Server) metrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+	for _, metric := range metricsRegistry {
+		metric.write(w)
+	}
+
+	fmt.Fprintf(w, "# HELP cricket_query_active_queries Queries running now.\n# TYPE cricket_query_active_queries gauge\ncricket_query_active_queries %d\n", s.engine.ActiveQueries())
+	fmt.Fprintf(w, "# HELP cricket_query_cancelled_queries_total Queries cancelled before finishing.\n# TYPE cricket_query_cancelled_queries_total counter\ncricket_query_cancelled_queries_total %d\n", s.engine.CancelledQueries())
+}
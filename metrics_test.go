@@ -0,0 +1,88 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"sean.mcgivern.me.uk/cricket-query/cricket"
+)
+
+func TestMetricWrite(t *testing.T) {
+	counter := newMetric("test_total", "A counter.", []string{"name"}, nil)
+	counter.inc("b")
+	counter.inc(`a "quoted" \ name`)
+	counter.inc("b")
+
+	histogram := newMetric("test_seconds", "A histogram.", []string{"name"}, []float64{0.1, 1})
+	histogram.observe(0.05, "a")
+	histogram.observe(0.5, "a")
+	histogram.observe(2, "a")
+
+	cases := []struct {
+		metric   *Metric
+		expected string
+	}{
+		{
+			counter,
+			`# HELP test_total A counter.
+# TYPE test_total counter
+test_total{name="a \"quoted\" \\ name"} 1
+test_total{name="b"} 2
+`,
+		},
+		{
+			histogram,
+			`# HELP test_seconds A histogram.
+# TYPE test_seconds histogram
+test_seconds_bucket{name="a",le="0.1"} 1
+test_seconds_bucket{name="a",le="1"} 2
+test_seconds_bucket{name="a",le="+Inf"} 3
+test_seconds_sum{name="a"} 2.55
+test_seconds_count{name="a"} 3
+`,
+		},
+	}
+
+	for _, c := range cases {
+		var out strings.Builder
+		c.metric.write(&out)
+
+		if diff := cmp.Diff(c.expected, out.String()); diff != "" {
+			t.Errorf("%s.write() mismatch (-expected +result):\n%s", c.metric.Name, diff)
+		}
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	observeQuery("test-metrics", cricket.Result{Rows: makeSingleRow(int64(1)), Messages: []string{}, Duration: time.Millisecond})
+	observeQuery("test-metrics", cricket.Result{Messages: []string{"interrupted (9)"}, Duration: time.Second})
+
+	notFound := instrument("test", http.NotFound)
+	notFound(httptest.NewRecorder(), httptest.NewRequest("GET", testServer.baseUrl("/missing"), nil))
+
+	w := httptest.NewRecorder()
+	testServer.metrics(w, httptest.NewRequest("GET", testServer.baseUrl("/metrics"), nil))
+	body := w.Body.String()
+
+	if contentType := w.Result().Header.Get("Content-Type"); contentType != "text/plain; version=0.0.4; charset=utf-8" {
+		t.Errorf("metrics() Content-Type == %q", contentType)
+	}
+
+	for _, line := range []string{
+		`cricket_query_requests_total{handler="test",code="404"} 1`,
+		`cricket_query_query_duration_seconds_bucket{projection="test-metrics",le="0.005"} 1`,
+		`cricket_query_query_rows_bucket{projection="test-metrics",le="1"} 1`,
+		`# TYPE cricket_query_query_errors_total counter`,
+		`cricket_query_query_duration_seconds_bucket{projection="test-metrics",le="1"} 2`,
+		"# TYPE cricket_query_saved_queries_total counter",
+		"cricket_query_active_queries 0",
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("metrics() does not contain %q:\n%s", line, body)
+		}
+	}
+}
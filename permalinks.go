@@ -0,0 +1,190 @@
+package main
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"sean.mcgivern.me.uk/cricket-query/cricket"
+)
+
+var permalinkEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+type Permalink struct {
+	Id          string `db:"id"`
+	SQL         string `db:"sql"`
+	Formats     string `db:"formats"`
+	Genders     string `db:"genders"`
+	Subtitle    string `db:"subtitle"`
+	Description string `db:"description"`
+	Dataset     string `db:"dataset"`
+	CreatedAt   string `db:"created_at"`
+}
+
+// connectStore opens the permalink store, which is a separate, writable
+// database, so that the innings database can stay read-only.
+func connectStore(path string) *sqlx.DB {
+	store := sqlx.MustConnect("sqlite", path)
+
+	store.MustExec(`
+CREATE TABLE IF NOT EXISTS permalinks (
+  id text PRIMARY KEY,
+  sql text NOT NULL,
+  formats text NOT NULL,
+  genders text NOT NULL,
+  subtitle text NOT NULL,
+  description text NOT NULL,
+  created_at text NOT NULL
+);`)
+
+	// Stores created before there were datasets don't have this column;
+	// their permalinks all used the default.
+	var hasDataset bool
+
+	if err := store.Get(&hasDataset, "SELECT EXISTS (SELECT 1 FROM pragma_table_info('permalinks') WHERE name = 'dataset');"); err != nil {
+		panic(err)
+	}
+
+	if !hasDataset {
+		store.MustExec("ALTER TABLE permalinks ADD COLUMN dataset text NOT NULL DEFAULT '';")
+	}
+
+	return store
+}
+
+func newPermalink(query cricket.Query) Permalink {
+	permalink := Permalink{
+		SQL:         query.SQL,
+		Formats:     strings.Join(cricket.CheckedValues(query.Formats), ","),
+		Genders:     strings.Join(cricket.CheckedValues(query.Genders), ","),
+		Subtitle:    query.Subtitle,
+		Description: query.Description,
+		Dataset:     query.Dataset,
+	}
+
+	// The default dataset is stored as blank, so that a link saved before
+	// there were datasets still means the same thing.
+	if permalink.Dataset == cricket.DefaultDataset {
+		permalink.Dataset = ""
+	}
+
+	// The ID is a hash of everything that affects what the page shows, so
+	// saving the same query twice gives the same link, and a link can never
+	// point to a different query.
+	fields := []string{permalink.SQL, permalink.Formats, permalink.Genders, permalink.Subtitle, permalink.Description}
+
+	if permalink.Dataset != "" {
+		fields = append(fields, permalink.Dataset)
+	}
+
+	content, _ := json.Marshal(fields)
+	sum := sha256.Sum256(content)
+
+	permalink.Id = strings.ToLower(permalinkEncoding.EncodeToString(sum[:])[:10])
+
+	return permalink
+}
+
+func splitValues(values string) []string {
+	if values == "" {
+		return []string{}
+	}
+
+	return strings.Split(values, ",")
+}
+
+func (p Permalink) Query() cricket.Query {
+	return cricket.Query{
+		SQL:         p.SQL,
+		Formats:     cricket.CheckboxValues(cricket.FormatValues, splitValues(p.Formats)),
+		Genders:     cricket.CheckboxValues(cricket.GenderValues, splitValues(p.Genders)),
+		Subtitle:    p.Subtitle,
+		Description: p.Description,
+		Dataset:     p.Dataset,
+	}
+}
+
+func savePermalink(store *sqlx.DB, permalink Permalink) error {
+	var existing Permalink
+
+	permalink.CreatedAt = time.Now().UTC().Format(time.RFC3339)
+
+	_, err := store.NamedExec(`
+INSERT INTO permalinks (id, sql, formats, genders, subtitle, description, dataset, created_at)
+VALUES (:id, :sql, :formats, :genders, :subtitle, :description, :dataset, :created_at)
+ON CONFLICT (id) DO NOTHING;`, permalink)
+	if err != nil {
+		return err
+	}
+
+	err = store.Get(&existing, "SELECT * FROM permalinks WHERE id = ?;", permalink.Id)
+	if err != nil {
+		return err
+	}
+
+	if existing.SQL != permalink.SQL || existing.Formats != permalink.Formats || existing.Genders != permalink.Genders || existing.Subtitle != permalink.Subtitle || existing.Description != permalink.Description || existing.Dataset != permalink.Dataset {
+		return fmt.Errorf("permalink %s already exists for a different query", permalink.Id)
+	}
+
+	return nil
+}
+
+func loadPermalink(store *sqlx.DB, id string) (permalink Permalink, err error) {
+	err = store.Get(&permalink, "SELECT * FROM permalinks WHERE id = ?;", id)
+
+	return
+}
+
+func (s *Server) permalinks(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, s.baseUrl("/q/"))
+
+	if id == "" {
+		if r.Method != http.MethodPost {
+			http.Redirect(w, r, s.baseUrl("/"), http.StatusSeeOther)
+			return
+		}
+
+		r.ParseForm()
+
+		dataset, ok := s.requestDataset(w, r, r.FormValue("dataset"))
+		if !ok {
+			return
+		}
+
+		permalink := newPermalink(cricket.Query{
+			SQL:         r.FormValue("sql"),
+			Formats:     cricket.CheckboxValues(cricket.FormatValues, r.Form["format"]),
+			Genders:     cricket.CheckboxValues(cricket.GenderValues, r.Form["gender"]),
+			Subtitle:    strings.TrimSpace(r.FormValue("subtitle")),
+			Description: strings.TrimSpace(r.FormValue("description")),
+			Dataset:     dataset.Name,
+		})
+
+		if err := savePermalink(s.store, permalink); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		http.Redirect(w, r, s.baseUrl("/q/"+permalink.Id), http.StatusSeeOther)
+		return
+	}
+
+	permalink, err := loadPermalink(s.store, id)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		http.NotFound(w, r)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s.showQuery(w, r, permalink.Query())
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"sean.mcgivern.me.uk/cricket-query/cricket"
+)
+
+func TestNewPermalink(t *testing.T) {
+	query := cricket.Query{
+		SQL:     "SELECT * FROM innings;",
+		Formats: cricket.CheckboxValues(cricket.FormatValues, []string{"test"}),
+		Genders: cricket.CheckboxValues(cricket.GenderValues, []string{}),
+	}
+	permalink := newPermalink(query)
+
+	if len(permalink.Id) != 10 || permalink.Formats != "test" || permalink.Genders != "men,women" {
+		t.Errorf("newPermalink(%v) == %v", query, permalink)
+	}
+
+	if newPermalink(query).Id != permalink.Id {
+		t.Errorf("newPermalink(%v) is not stable", query)
+	}
+
+	query.Subtitle = "Innings"
+
+	if newPermalink(query).Id == permalink.Id {
+		t.Errorf("newPermalink(%v) did not change with the subtitle", query)
+	}
+}
+
+func TestSavePermalink(t *testing.T) {
+	permalink := newPermalink(cricket.Query{
+		SQL:         "SELECT COUNT(*) FROM innings;",
+		Formats:     cricket.CheckboxValues(cricket.FormatValues, []string{"odi", "t20i"}),
+		Genders:     cricket.CheckboxValues(cricket.GenderValues, []string{"women"}),
+		Subtitle:    "Count",
+		Description: "How many innings?",
+	})
+
+	for i := 0; i < 2; i++ {
+		if err := savePermalink(testServer.store, permalink); err != nil {
+			t.Fatalf("savePermalink(store, %v) returned error: %v", permalink, err)
+		}
+	}
+
+	loaded, err := loadPermalink(testServer.store, permalink.Id)
+	if err != nil {
+		t.Fatalf("loadPermalink(store, %q) returned error: %v", permalink.Id, err)
+	}
+
+	if query := loaded.Query(); query.SQL != "SELECT COUNT(*) FROM innings;" || !query.Formats[1].Checked || query.Formats[0].Checked || query.Genders[0].Checked || query.Subtitle != "Count" {
+		t.Errorf("loadPermalink(store, %q).Query() == %v", permalink.Id, query)
+	}
+
+	changed := permalink
+	changed.SQL = "SELECT 1;"
+
+	if err := savePermalink(testServer.store, changed); err == nil {
+		t.Errorf("savePermalink(store, %v) did not return an error for a changed query", changed)
+	}
+}
+
+func TestPermalinks(t *testing.T) {
+	form := url.Values{
+		"sql":      []string{"SELECT runs FROM innings ORDER BY runs DESC LIMIT 1;"},
+		"format":   []string{"test"},
+		"gender":   []string{"women"},
+		"subtitle": []string{"Highest score"},
+	}
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", testServer.baseUrl("/q/"), strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	testServer.permalinks(w, r)
+
+	location := w.Header().Get("Location")
+
+	if w.Code != 303 || !strings.HasPrefix(location, testServer.baseUrl("/q/")) {
+		t.Fatalf("permalinks(POST) == %d %q", w.Code, location)
+	}
+
+	w = httptest.NewRecorder()
+	testServer.permalinks(w, httptest.NewRequest("GET", location, nil))
+
+	if w.Code != 200 || !strings.Contains(w.Body.String(), "<h2>Highest score</h2>") || !strings.Contains(w.Body.String(), "Women&#39;s Test") {
+		t.Errorf("permalinks(GET %q) == %d", location, w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	testServer.permalinks(w, httptest.NewRequest("GET", testServer.baseUrl("/q/missing"), nil))
+
+	if w.Code != 404 {
+		t.Errorf("permalinks(GET %q) == %d, want 404", testServer.baseUrl("/q/missing"), w.Code)
+	}
+}
@@ -0,0 +1,345 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"sean.mcgivern.me.uk/cricket-query/cricket"
+)
+
+// How many players a search returns.
+const playerSearchLimit = 20
+
+var matchPlayerId = regexp.MustCompile(`\Ap\d+\z`)
+var matchTrailingLimit = regexp.MustCompile(`(?i)\s+LIMIT\s+\d+\s*;?\s*\z`)
+
+// Player is everything the players table knows about one player_id, across
+// every gender and format.
+type Player struct {
+	Id      string   `json:"id"`
+	Names   []string `json:"names"`
+	Teams   []string `json:"teams"`
+	Formats []string `json:"formats"`
+	First   string   `json:"first"`
+	Last    string   `json:"last"`
+	Innings int64    `json:"innings"`
+}
+
+type playerRow struct {
+	PlayerId       string `db:"player_id"`
+	Player         string `db:"player"`
+	Gender         string `db:"gender"`
+	Format         string `db:"format"`
+	Team           string `db:"team"`
+	FirstDate      string `db:"first_date"`
+	LastDate       string `db:"last_date"`
+	BattingInnings int64  `db:"batting_innings"`
+	BowlingInnings int64  `db:"bowling_innings"`
+}
+
+// PlayerQuery is a saved query filtered to one player.
+type PlayerQuery struct {
+	Name     string
+	Subtitle string
+	Url      string
+}
+
+// playerSearch turns what someone typed into an FTS5 query matching names
+// with every word as a prefix, so "smi ste" finds "SPD Smith" and
+// "Steve Smith" alike. Anything but letters and digits separates words,
+// so it can't be used to write FTS5 syntax.
+func playerSearch(q string) string {
+	words := strings.FieldsFunc(q, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+
+	for i, word := range words {
+		words[i] = `"` + word + `"*`
+	}
+
+	return strings.Join(words, " ")
+}
+
+// collectPlayers merges the rows for each player_id, keeping the order in
+// which they first appear.
+func collectPlayers(rows []playerRow) (out []Player) {
+	index := make(map[string]int)
+
+	for _, row := range rows {
+		i, ok := index[row.PlayerId]
+
+		if !ok {
+			i = len(out)
+			index[row.PlayerId] = i
+			out = append(out, Player{Id: row.PlayerId, First: row.FirstDate, Last: row.LastDate})
+		}
+
+		p := &out[i]
+		format := fmt.Sprintf("%s-%s", row.Gender, row.Format)
+
+		if !inArray(row.Player, p.Names) {
+			p.Names = append(p.Names, row.Player)
+		}
+
+		if !inArray(row.Team, p.Teams) {
+			p.Teams = append(p.Teams, row.Team)
+		}
+
+		if !inArray(format, p.Formats) {
+			p.Formats = append(p.Formats, format)
+		}
+
+		if row.FirstDate < p.First {
+			p.First = row.FirstDate
+		}
+
+		if row.LastDate > p.Last {
+			p.Last = row.LastDate
+		}
+
+		p.Innings += row.BattingInnings + row.BowlingInnings
+	}
+
+	return
+}
+
+// FormatLabels returns the player's formats as they're shown in headers:
+// "Men's Test" and so on.
+func (p Player) FormatLabels() (out []string) {
+	for _, gender := range cricket.GenderValues {
+		for _, format := range cricket.FormatValues {
+			if inArray(fmt.Sprintf("%s-%s", gender.Value, format.Value), p.Formats) {
+				out = append(out, fmt.Sprintf("%s's %s", gender.Label, format.Label))
+			}
+		}
+	}
+
+	return
+}
+
+// selectPlayers returns the players whose rows sql selects, from the
+// dataset in ctx.
+func (e *Engine) selectPlayers(ctx context.Context, sql string, args ...any) ([]Player, error) {
+	var rows []playerRow
+
+	if err := e.SelectRows(ctx, "players", &rows, sql, args...); err != nil {
+		return nil, err
+	}
+
+	return collectPlayers(rows), nil
+}
+
+// searchPlayers returns the players with a name matching q, best first.
+func (e *Engine) searchPlayers(ctx context.Context, q string) ([]Player, error) {
+	search := playerSearch(q)
+
+	if search == "" {
+		return nil, nil
+	}
+
+	return e.selectPlayers(ctx, `
+SELECT players.*
+FROM (
+  SELECT player_id, min(rank) AS rank
+  FROM players_fts
+  WHERE players_fts MATCH ?
+  GROUP BY player_id
+  ORDER BY rank
+  LIMIT ?
+) AS matches
+INNER JOIN players USING (player_id)
+ORDER BY matches.rank, players.player_id, players.first_date;`, search, playerSearchLimit)
+}
+
+var errNoPlayer = errors.New("no such player")
+
+func (e *Engine) loadPlayer(ctx context.Context, id string) (Player, error) {
+	players, err := e.selectPlayers(ctx, "SELECT * FROM players WHERE player_id = ? ORDER BY first_date;", id)
+
+	if err != nil {
+		return Player{}, err
+	} else if len(players) == 0 {
+		return Player{}, errNoPlayer
+	}
+
+	return players[0], nil
+}
+
+// playerQueries returns the names of the saved queries with a player_id
+// column, which can be filtered to one player. Finding them means running
+// each one, so the list is kept with the database in ctx, but only if every
+// query ran; otherwise the next call tries again.
+func (e *Engine) playerQueries(ctx context.Context) []string {
+	var names []string
+	var found []string
+
+	db, done, err := e.UseDatabase(cricket.DatasetName(ctx))
+	if err != nil {
+		return nil
+	}
+	defer done()
+
+	if cached, ok := db.Values.Load(playerQueriesValue); ok {
+		return cached.([]string)
+	}
+
+	for name := range e.SavedQueries {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	complete := true
+
+	for _, name := range names {
+		sql := fmt.Sprintf("SELECT * FROM (\n%s\n) LIMIT 0;", withoutLimit(e.SavedQueries[name].SQL))
+		result := e.RunQuery(ctx, cricket.AddAliases("men", "test", sql), 1, e.Timeout)
+
+		if len(result.Messages) > 0 {
+			complete = false
+		} else if inArray("player_id", result.Columns) {
+			found = append(found, name)
+		}
+	}
+
+	if complete {
+		db.Values.Store(playerQueriesValue, found)
+	}
+
+	return found
+}
+
+// withoutLimit strips the trailing semicolon and LIMIT from a query, so
+// that a player's rows are found wherever they rank.
+func withoutLimit(sql string) string {
+	return strings.TrimSuffix(strings.TrimSpace(matchTrailingLimit.ReplaceAllString(sql, "")), ";")
+}
+
+// playerQueryLinks links to each saved query with a player_id column,
+// filtered to p and limited to the formats and genders they played.
+func (s *Server) playerQueryLinks(ctx context.Context, p Player, dataset string) (out []PlayerQuery) {
+	formats, genders := projectionValues(p.Formats)
+
+	for _, name := range s.engine.playerQueries(ctx) {
+		query := s.engine.SavedQueries[name]
+		values := url.Values{
+			"sql":    []string{fmt.Sprintf("SELECT * FROM (\n%s\n) WHERE player_id = '%s';", withoutLimit(query.SQL), p.Id)},
+			"format": formats,
+			"gender": genders,
+		}
+
+		if dataset != cricket.DefaultDataset {
+			values.Set("dataset", dataset)
+		}
+
+		out = append(out, PlayerQuery{name, query.Subtitle, s.baseUrl("/?" + values.Encode())})
+	}
+
+	return
+}
+
+// playersApi returns the players matching q as JSON.
+func (s *Server) playersApi(w http.ResponseWriter, r *http.Request) {
+	dataset, ok := s.requestDataset(w, r, r.FormValue("dataset"))
+	if !ok {
+		return
+	}
+
+	players, err := s.engine.searchPlayers(cricket.WithDataset(r.Context(), dataset.Name), r.FormValue("q"))
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if players == nil {
+		players = []Player{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(players)
+}
+
+// player shows a search form at /player/, and a player's page at
+// /player/<id>.
+func (s *Server) player(w http.ResponseWriter, r *http.Request) {
+	var players []Player
+	var player Player
+	var queries []PlayerQuery
+	var career []SectionResult
+	var err error
+
+	id := strings.TrimPrefix(r.URL.Path, s.baseUrl("/player/"))
+	q := strings.TrimSpace(r.FormValue("q"))
+	dataset, ok := s.requestDataset(w, r, r.FormValue("dataset"))
+	if !ok {
+		return
+	}
+
+	ctx := cricket.WithDataset(r.Context(), dataset.Name)
+
+	if id == "" {
+		players, err = s.engine.searchPlayers(ctx, q)
+	} else if !matchPlayerId.MatchString(id) {
+		err = errNoPlayer
+	} else if player, err = s.engine.loadPlayer(ctx, id); err == nil {
+		queries = s.playerQueryLinks(ctx, player, dataset.Name)
+		career = s.engine.playerCareer(ctx, player)
+		s.linkSections(career, player.Formats, dataset.Name)
+	}
+
+	if err == errNoPlayer {
+		http.NotFound(w, r)
+		return
+	}
+
+	messages := make([]string, 0)
+	if err != nil {
+		messages = append(messages, err.Error())
+	}
+
+	title := "Cricket query players"
+	if len(player.Names) > 0 {
+		title = strings.Join(player.Names, " / ")
+	}
+
+	s.executeTemplate(w, "player.html", Page{
+		Title: title,
+		Content: struct {
+			Search   string
+			Players  []Player
+			Player   Player
+			Queries  []PlayerQuery
+			Career   []SectionResult
+			Messages []string
+			Datasets []cricket.Dataset
+			Dataset  cricket.Dataset
+		}{
+			q,
+			players,
+			player,
+			queries,
+			career,
+			messages,
+			s.engine.Datasets,
+			dataset,
+		},
+	})
+}
+
+// playerUrl links to a player's page, in the dataset if it isn't the
+// default.
+func (s *Server) playerUrl(id string, dataset string) string {
+	if dataset != "" && dataset != cricket.DefaultDataset {
+		return s.baseUrl("/player/" + id + "?" + url.Values{"dataset": []string{dataset}}.Encode())
+	}
+
+	return s.baseUrl("/player/" + id)
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"sean.mcgivern.me.uk/cricket-query/cricket"
+)
+
+func TestPlayerSearch(t *testing.T) {
+	cases := []struct {
+		q        string
+		expected string
+	}{
+		{"", ""},
+		{"  ", ""},
+		{"smith", `"smith"*`},
+		{"SPD Smith", `"SPD"* "Smith"*`},
+		{`smith" OR "x`, `"smith"* "OR"* "x"*`},
+		{"d'oliveira", `"d"* "oliveira"*`},
+		{"player_id:*", `"player"* "id"*`},
+	}
+
+	for _, c := range cases {
+		if result := playerSearch(c.q); result != c.expected {
+			t.Errorf("playerSearch(%q) == %q, want %q", c.q, result, c.expected)
+		}
+	}
+}
+
+func TestPlayerQueries(t *testing.T) {
+	live, done, _ := testEngine.UseDatabase(cricket.DefaultDataset)
+	done()
+
+	e := newEngine(cricket.MustOpen(live.Path), defaultConfig())
+	e.SavedQueries = map[string]cricket.Query{
+		"batting": cricket.Query{SQL: "SELECT player_id, runs FROM innings LIMIT 10;"},
+		"teams":   cricket.Query{SQL: "SELECT team FROM team_innings;"},
+		"broken":  cricket.Query{SQL: "SELECT player_id FROM missing;"},
+	}
+
+	if names := e.playerQueries(context.Background()); strings.Join(names, ",") != "batting" {
+		t.Errorf("playerQueries() == %v, want [batting]", names)
+	}
+
+	db, done, _ := e.UseDatabase(cricket.DefaultDataset)
+	defer done()
+
+	if _, ok := db.Values.Load(playerQueriesValue); ok {
+		t.Errorf("playerQueries() kept a list with a query that failed")
+	}
+
+	e.SavedQueries["broken"] = cricket.Query{SQL: "SELECT player_id FROM innings;"}
+
+	if names := e.playerQueries(context.Background()); strings.Join(names, ",") != "batting,broken" {
+		t.Errorf("playerQueries() == %v, want [batting broken]", names)
+	}
+
+	if cached, ok := db.Values.Load(playerQueriesValue); !ok || len(cached.([]string)) != 2 {
+		t.Errorf("playerQueries() did not keep a complete list")
+	}
+
+	if err := e.Reload(cricket.DefaultDataset, live.Path, time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded, done, _ := e.UseDatabase(cricket.DefaultDataset)
+	defer done()
+
+	if _, ok := reloaded.Values.Load(playerQueriesValue); ok {
+		t.Errorf("a reloaded database has the old list of player queries")
+	}
+}
+
+func TestCollectPlayers(t *testing.T) {
+	rows := []playerRow{
+		{"p2", "B Two", "men", "odi", "England", "2001-01-01", "2002-01-01", 3, 0},
+		{"p1", "A One", "men", "test", "Australia", "1990-01-01", "1995-01-01", 10, 5},
+		{"p2", "B Two", "men", "test", "England", "1999-01-01", "2000-01-01", 2, 1},
+		{"p2", "BB Two", "women", "test", "World XI", "2005-01-01", "2005-01-01", 1, 0},
+	}
+
+	expected := []Player{
+		{"p2", []string{"B Two", "BB Two"}, []string{"England", "World XI"}, []string{"men-odi", "men-test", "women-test"}, "1999-01-01", "2005-01-01", 7},
+		{"p1", []string{"A One"}, []string{"Australia"}, []string{"men-test"}, "1990-01-01", "1995-01-01", 15},
+	}
+
+	if diff := cmp.Diff(expected, collectPlayers(rows)); diff != "" {
+		t.Errorf("collectPlayers() mismatch (-expected +result):\n%s", diff)
+	}
+
+	if labels := expected[0].FormatLabels(); strings.Join(labels, ", ") != "Men's Test, Men's ODI, Women's Test" {
+		t.Errorf("FormatLabels() == %v", labels)
+	}
+}
+
+func TestWithoutLimit(t *testing.T) {
+	cases := []struct {
+		sql      string
+		expected string
+	}{
+		{"SELECT * FROM innings;", "SELECT * FROM innings"},
+		{"SELECT * FROM innings ORDER BY runs DESC LIMIT 10;", "SELECT * FROM innings ORDER BY runs DESC"},
+		{"SELECT * FROM innings\nlimit 10", "SELECT * FROM innings"},
+		{"SELECT * FROM (SELECT * FROM innings LIMIT 10) ORDER BY runs;", "SELECT * FROM (SELECT * FROM innings LIMIT 10) ORDER BY runs"},
+	}
+
+	for _, c := range cases {
+		if result := withoutLimit(c.sql); result != c.expected {
+			t.Errorf("withoutLimit(%q) == %q, want %q", c.sql, result, c.expected)
+		}
+	}
+}
+
+func TestPlayersApi(t *testing.T) {
+	cases := []struct {
+		q        string
+		expected []string
+	}{
+		{"bannerman", []string{"p4091"}},
+		{"BANN", []string{"p4091"}},
+		{"c+bann", []string{"p4091"}},
+		{"nobody", []string{}},
+		{"", []string{}},
+	}
+
+	for _, c := range cases {
+		var players []Player
+
+		w := httptest.NewRecorder()
+		testServer.playersApi(w, httptest.NewRequest("GET", testServer.baseUrl("/api/players?q="+c.q), nil))
+
+		if err := json.Unmarshal(w.Body.Bytes(), &players); err != nil || w.Header().Get("Content-Type") != "application/json" {
+			t.Errorf("playersApi(%q) == %q, %v", c.q, w.Body.String(), err)
+			continue
+		}
+
+		ids := make([]string, 0)
+		for _, player := range players {
+			ids = append(ids, player.Id)
+		}
+
+		if diff := cmp.Diff(c.expected, ids); diff != "" {
+			t.Errorf("playersApi(%q) mismatch (-expected +result):\n%s", c.q, diff)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	testServer.playersApi(w, httptest.NewRequest("GET", testServer.baseUrl("/api/players?q=bannerman"), nil))
+
+	if !strings.Contains(w.Body.String(), `"names":["C Bannerman"],"teams":["Australia"],"formats":["men-test"],"first":"1877-03-15"`) {
+		t.Errorf("playersApi(%q) == %s", "bannerman", w.Body.String())
+	}
+}
+
+func TestSearchPlayersLimited(t *testing.T) {
+	live, done, _ := testEngine.UseDatabase(cricket.DefaultDataset)
+	done()
+
+	c := defaultConfig()
+	c.MaxQueries = 1
+	c.QueueTimeout = 1
+	e := newEngine(cricket.MustOpen(live.Path), c)
+
+	release, err := e.Limiter.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if players, err := e.searchPlayers(context.Background(), "bannerman"); err != cricket.ErrServerBusy {
+		t.Errorf("searchPlayers() with no free slots == %v, %v, want %v", players, err, cricket.ErrServerBusy)
+	}
+
+	release()
+
+	if players, err := e.searchPlayers(context.Background(), "bannerman"); err != nil || len(players) != 1 {
+		t.Errorf("searchPlayers() == %v, %v", players, err)
+	}
+}
+
+func TestPlayer(t *testing.T) {
+	cases := []struct {
+		path     string
+		code     int
+		expected []string
+	}{
+		{"/player/", 200, []string{`<input type="search" name="q" id="q" value=""`}},
+		{"/player/?q=bannerman", 200, []string{`href="/cricket-query/player/p4091"`, "C Bannerman"}},
+		{"/player/?q=nobody", 200, []string{"No players found."}},
+		{
+			"/player/p4091",
+			200,
+			[]string{
+				"<h1>C Bannerman</h1>",
+				"<tr><th>Teams</th><td>Australia</td></tr>",
+				"<tr><th>Formats</th><td>Men&#39;s Test</td></tr>",
+				"15 March 1877 to 15 March 1877",
+				`<h2 id="career">Career`,
+				`<h2 id="years">Year by year`,
+				`<td data-sort="165*">165*</td>`,
+				"Open in editor</a>",
+				">Fewer runs than innings</a>",
+				"%29&#43;WHERE&#43;player_id&#43;%3D&#43;%27p4091%27%3B",
+			},
+		},
+		{"/player/p1", 404, nil},
+		{"/player/smith", 404, nil},
+	}
+
+	for _, c := range cases {
+		w := httptest.NewRecorder()
+		testServer.player(w, httptest.NewRequest("GET", testServer.baseUrl(c.path), nil))
+
+		if w.Code != c.code {
+			t.Errorf("player(%q) == %d, want %d", c.path, w.Code, c.code)
+		}
+
+		for _, expected := range c.expected {
+			if !strings.Contains(w.Body.String(), expected) {
+				t.Errorf("player(%q) did not contain %q:\n%s", c.path, expected, w.Body.String())
+			}
+		}
+	}
+}
@@ -0,0 +1,350 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"sean.mcgivern.me.uk/cricket-query/cricket"
+)
+
+// How many failing rows to show for each check and projection.
+const qualitySampleSize = 5
+
+// How long each check query can take. The report is only built once for
+// each database, so this is much longer than the usual query timeout.
+const qualityTimeout = 60000
+
+// QualityCheck is a query, using the usual table aliases, that returns the
+// rows with a data-quality problem. It can't start with WITH, as it's
+// wrapped to count the rows.
+type QualityCheck struct {
+	Id          string
+	Title       string
+	Description string
+	SQL         string
+}
+
+// QualityFailure is how many rows failed a check for one projection, with
+// a sample of them.
+type QualityFailure struct {
+	Header string
+	Id     string
+	Count  int64
+	Sample cricket.Result
+}
+
+type QualityResult struct {
+	Check    QualityCheck
+	Count    int64
+	Failures []QualityFailure
+}
+
+// QualityReport is the result of every check. It's incomplete if a check
+// was turned away by the limiter or timed out, so it says nothing about
+// that check's data.
+type QualityReport struct {
+	Results    []QualityResult
+	Duration   time.Duration
+	Incomplete bool
+}
+
+var qualityChecks = []QualityCheck{
+	{
+		"batting-total",
+		"Batters scoring more than the team total",
+		"Extras aren't in the data, so the batters' runs usually add up to less than the team's; more than the team's is a mistake in one or the other.",
+		`SELECT team_innings.match_id, team_innings.innings, team_innings.team, team_innings.runs AS team_runs, batting.runs AS batting_runs
+FROM (
+  SELECT match_id, innings, team, start_date, max(runs) AS runs
+  FROM team_innings
+  GROUP BY match_id, innings, team, start_date
+) AS team_innings
+INNER JOIN (
+  SELECT match_id, innings, team, sum(runs) AS runs
+  FROM innings
+  GROUP BY match_id, innings, team
+) AS batting ON
+  batting.match_id = team_innings.match_id AND
+  batting.innings = team_innings.innings AND
+  batting.team = team_innings.team
+WHERE batting.runs > team_innings.runs
+ORDER BY team_innings.start_date, team_innings.match_id, team_innings.innings`,
+	},
+	{
+		"missing-matches",
+		"Matches missing from a table",
+		"Every match should be in the batting, bowling and team tables. Matches abandoned before a ball was bowled can legitimately be missing from some.",
+		`SELECT
+  match_id,
+  CASE max(batting) WHEN 1 THEN 'yes' ELSE 'no' END AS batting,
+  CASE max(bowling) WHEN 1 THEN 'yes' ELSE 'no' END AS bowling,
+  CASE max(team) WHEN 1 THEN 'yes' ELSE 'no' END AS team
+FROM (
+  SELECT DISTINCT match_id, 1 AS batting, 0 AS bowling, 0 AS team FROM innings
+  UNION ALL
+  SELECT DISTINCT match_id, 0, 1, 0 FROM bowling_innings
+  UNION ALL
+  SELECT DISTINCT match_id, 0, 0, 1 FROM team_innings
+)
+GROUP BY match_id
+HAVING max(batting) = 0 OR max(bowling) = 0 OR max(team) = 0
+ORDER BY match_id`,
+	},
+	{
+		"player-names",
+		"Players with more than one name",
+		"A player_id should always have the same player name in the batting and bowling tables.",
+		`SELECT player_id, count(*) AS names, group_concat(player, ', ') AS players
+FROM (
+  SELECT DISTINCT player_id, player FROM innings
+  UNION
+  SELECT DISTINCT player_id, player FROM bowling_innings
+)
+GROUP BY player_id
+HAVING count(*) > 1
+ORDER BY player_id`,
+	},
+	{
+		"impossible-values",
+		"Impossible values",
+		"Negative runs, balls or wickets, more than ten wickets, and booleans that aren't 'True' or 'False'.",
+		`SELECT 'batting' AS "table", match_id, player, 'runs' AS "column", runs AS value FROM innings WHERE runs < 0
+UNION ALL
+SELECT 'batting', match_id, player, 'bf', bf FROM innings WHERE bf < 0
+UNION ALL
+SELECT 'batting', match_id, player, 'not_out', not_out FROM innings WHERE not_out NOT IN ('True', 'False')
+UNION ALL
+SELECT 'bowling', match_id, player, 'runs', runs FROM bowling_innings WHERE runs < 0
+UNION ALL
+SELECT 'bowling', match_id, player, 'balls', balls FROM bowling_innings WHERE balls < 0
+UNION ALL
+SELECT 'bowling', match_id, player, 'wickets', wickets FROM bowling_innings WHERE wickets < 0 OR wickets > 10
+UNION ALL
+SELECT 'team', match_id, team, 'all_out', all_out FROM team_innings WHERE all_out NOT IN ('True', 'False')
+UNION ALL
+SELECT 'team', match_id, team, 'declared', declared FROM team_innings WHERE declared NOT IN ('True', 'False')`,
+	},
+	{
+		"unmapped-grounds",
+		"Grounds missing from the mappings",
+		"Every ground should be in mappings/grounds.csv, or its matches are home for whichever team has played there most.",
+		`SELECT ground, count(DISTINCT match_id) AS matches, min(start_date) AS first, max(start_date) AS last
+FROM team_innings
+WHERE ground_country IS NULL
+GROUP BY ground
+ORDER BY ground`,
+	},
+	{
+		"date-gaps",
+		"Gaps of over two years between matches",
+		"Long gaps can mean matches are missing. Some are real, like the world wars, and the early years of women's cricket.",
+		`SELECT previous AS "from", start_date AS "to", CAST(julianday(start_date) - julianday(previous) AS integer) AS days
+FROM (
+  SELECT start_date, lag(start_date) OVER (ORDER BY start_date) AS previous
+  FROM (SELECT DISTINCT start_date FROM team_innings)
+)
+WHERE julianday(start_date) - julianday(previous) > 730
+ORDER BY start_date`,
+	},
+}
+
+// runQualityChecks runs every check against every projection of the named
+// dataset. It doesn't use a request's context, so that the report isn't
+// cut short or counted against a client's rate limit.
+func (e *Engine) runQualityChecks(dataset string) *QualityReport {
+	ctx := cricket.WithDataset(context.Background(), dataset)
+	report := &QualityReport{}
+	start := time.Now()
+
+	for _, check := range qualityChecks {
+		result := QualityResult{Check: check}
+
+		for _, gender := range cricket.GenderValues {
+			for _, format := range cricket.FormatValues {
+				failure := QualityFailure{
+					Header: fmt.Sprintf("%s's %s", gender.Label, format.Label),
+					Id:     fmt.Sprintf("%s-%s", gender.Value, format.Value),
+				}
+
+				count := e.RunQuery(ctx, cricket.AddAliases(gender.Value, format.Value, "SELECT count(*) FROM ("+check.SQL+")"), 1, qualityTimeout)
+
+				if len(count.Messages) > 0 {
+					failure.Sample = count
+				} else if failure.Count, _ = count.Rows[0][0].(int64); failure.Count > 0 {
+					failure.Sample = e.RunQuery(ctx, cricket.AddAliases(gender.Value, format.Value, fmt.Sprintf("%s LIMIT %d", check.SQL, qualitySampleSize)), qualitySampleSize, qualityTimeout)
+				} else {
+					continue
+				}
+
+				report.Incomplete = report.Incomplete || cutShort(failure.Sample)
+				result.Count += failure.Count
+				result.Failures = append(result.Failures, failure)
+			}
+		}
+
+		report.Results = append(report.Results, result)
+	}
+
+	report.Duration = time.Now().Sub(start)
+
+	return report
+}
+
+// cutShort returns whether a query was turned away by the limiter or timed
+// out, rather than failing because of its SQL.
+func cutShort(result cricket.Result) bool {
+	for _, message := range result.Messages {
+		switch cricket.ErrorType(message) {
+		case "timeout", "busy", "rate_limited":
+			return true
+		}
+	}
+
+	return false
+}
+
+// refreshQuality starts building the report for the named dataset's
+// database in the background, unless it already has a complete one or a
+// build is running. The report only changes when the database does, so
+// this is called when one is mounted or reloaded, and again after a build
+// that was cut short.
+func (e *Engine) refreshQuality(dataset string) {
+	db, done, err := e.UseDatabase(dataset)
+	if err != nil {
+		return
+	}
+	defer done()
+
+	if report, ok := db.Values.Load(qualityValue); ok && !report.(*QualityReport).Incomplete {
+		return
+	}
+
+	if _, building := db.Values.LoadOrStore(buildingQualityValue, true); building {
+		return
+	}
+
+	go func() {
+		defer db.Values.Delete(buildingQualityValue)
+
+		db.Values.Store(qualityValue, e.runQualityChecks(dataset))
+	}()
+}
+
+// dataQuality returns the latest report for the named dataset, which is nil
+// until the first build finishes. It never waits for a build, as that can
+// take longer than a request is allowed.
+func (e *Engine) dataQuality(dataset string) (*QualityReport, error) {
+	db, done, err := e.UseDatabase(dataset)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	e.refreshQuality(dataset)
+	report, _ := db.Values.Load(qualityValue)
+	latest, _ := report.(*QualityReport)
+
+	return latest, nil
+}
+
+// failed returns whether any check found a problem or couldn't be run.
+func (r *QualityReport) failed() bool {
+	for _, result := range r.Results {
+		if len(result.Failures) > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// write prints the report as text, for the data-quality command.
+func (r *QualityReport) write(w io.Writer) {
+	for _, result := range r.Results {
+		fmt.Fprintf(w, "%s: %d (%s)\n", result.Check.Id, result.Count, result.Check.Title)
+
+		for _, failure := range result.Failures {
+			fmt.Fprintf(w, "  %s: %d\n", failure.Id, failure.Count)
+
+			for _, message := range failure.Sample.Messages {
+				fmt.Fprintf(w, "    error: %s\n", message)
+			}
+
+			if len(failure.Sample.Columns) > 0 {
+				fmt.Fprintf(w, "    %s\n", strings.Join(failure.Sample.Columns, "\t"))
+			}
+
+			for _, row := range failure.Sample.Rows {
+				values := make([]string, len(row))
+				for i, value := range row {
+					values[i] = sortValue(value)
+				}
+
+				fmt.Fprintf(w, "    %s\n", strings.Join(values, "\t"))
+			}
+		}
+	}
+}
+
+// writeDataQuality builds and prints the report for every dataset,
+// returning whether any check failed.
+func (e *Engine) writeDataQuality(w io.Writer) (failed bool) {
+	for _, dataset := range e.Datasets {
+		report := e.runQualityChecks(dataset.Name)
+
+		if len(e.Datasets) > 1 {
+			fmt.Fprintf(w, "# %s\n", dataset.Name)
+		}
+
+		report.write(w)
+		failed = failed || report.failed()
+	}
+
+	return
+}
+
+func (s *Server) dataQuality(w http.ResponseWriter, r *http.Request) {
+	dataset, ok := s.requestDataset(w, r, r.FormValue("dataset"))
+	if !ok {
+		return
+	}
+
+	report, err := s.engine.dataQuality(dataset.Name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s.executeTemplate(w, "data-quality.html", Page{
+		Title: "Cricket query data quality",
+		Content: struct {
+			Report     *QualityReport
+			SampleSize int
+			Datasets   []cricket.Dataset
+			Dataset    cricket.Dataset
+		}{
+			report,
+			qualitySampleSize,
+			s.engine.Datasets,
+			dataset,
+		},
+	})
+}
+
+// checkUrl opens a check's query in the editor, for one projection of a
+// dataset.
+func (s *Server) checkUrl(check QualityCheck, id string, dataset string) string {
+	parts := strings.SplitN(id, "-", 2)
+	values := url.Values{"sql": []string{check.SQL}, "gender": []string{parts[0]}, "format": []string{parts[1]}}
+
+	if dataset != cricket.DefaultDataset {
+		values.Set("dataset", dataset)
+	}
+
+	return s.baseUrl("/?" + values.Encode())
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/jmoiron/sqlx"
+	"sean.mcgivern.me.uk/cricket-query/cricket"
+)
+
+func TestRunQualityChecks(t *testing.T) {
+	live, done, _ := testEngine.UseDatabase(cricket.DefaultDataset)
+	done()
+
+	content, err := os.ReadFile(live.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "innings.sqlite3")
+	os.WriteFile(path, content, 0644)
+	sqlx.MustConnect("sqlite", path).MustExec(`
+UPDATE men_test_batting_innings SET runs = 500 WHERE rowid = 1;
+UPDATE men_test_bowling_innings SET player_id = 'p7948' WHERE rowid = 1;
+UPDATE men_odi_batting_innings SET not_out = 'maybe' WHERE rowid = 1;
+UPDATE men_odi_batting_innings SET bf = -1 WHERE rowid = 2;
+UPDATE women_test_team_innings SET start_date = '1940-01-04' WHERE rowid = 5;
+UPDATE men_t20i_team_innings SET ground_country = NULL WHERE ground = 'Auckland';`)
+
+	e := newEngine(cricket.MustOpen(path), defaultConfig())
+	report := e.runQualityChecks(cricket.DefaultDataset)
+	counts := map[string]map[string]int64{}
+
+	for _, result := range report.Results {
+		counts[result.Check.Id] = map[string]int64{}
+
+		for _, failure := range result.Failures {
+			if len(failure.Sample.Messages) > 0 {
+				t.Errorf("%s for %s returned %v", result.Check.Id, failure.Id, failure.Sample.Messages)
+			}
+
+			if int64(len(failure.Sample.Rows)) != failure.Count && len(failure.Sample.Rows) != qualitySampleSize {
+				t.Errorf("%s for %s has %d sample rows of %d", result.Check.Id, failure.Id, len(failure.Sample.Rows), failure.Count)
+			}
+
+			counts[result.Check.Id][failure.Id] = failure.Count
+		}
+	}
+
+	expected := map[string]map[string]int64{
+		"batting-total":     {"men-test": 1},
+		"missing-matches":   {"men-test": 1, "men-odi": 2, "men-t20i": 2, "women-test": 1, "women-odi": 2, "women-t20i": 2},
+		"player-names":      {"men-test": 1},
+		"impossible-values": {"men-odi": 2},
+		"unmapped-grounds":  {"men-t20i": 1},
+		"date-gaps":         {"women-test": 1},
+	}
+
+	if diff := cmp.Diff(expected, counts); diff != "" {
+		t.Errorf("runQualityChecks() mismatch (-expected +result):\n%s", diff)
+	}
+
+	if !report.failed() {
+		t.Errorf("failed() == false for a report with failures")
+	}
+
+	first := waitForQuality(t, e, cricket.DefaultDataset)
+
+	if second, _ := e.dataQuality(cricket.DefaultDataset); first != second {
+		t.Errorf("dataQuality() built a complete report twice for the same database")
+	}
+
+	var out bytes.Buffer
+
+	if !e.writeDataQuality(&out) || !strings.Contains(out.String(), "player-names: 1 (Players with more than one name)\n  men-test: 1\n    player_id\tnames\tplayers\n    p7948\t2\t") {
+		t.Errorf("writeDataQuality() wrote:\n%s", out.String())
+	}
+}
+
+// waitForQuality waits for the background build of the dataset's report
+// to finish.
+func waitForQuality(t *testing.T, e *Engine, dataset string) *QualityReport {
+	deadline := time.Now().Add(30 * time.Second)
+
+	for time.Now().Before(deadline) {
+		if report, err := e.dataQuality(dataset); err != nil {
+			t.Fatal(err)
+		} else if report != nil && !report.Incomplete {
+			return report
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatalf("the %s data-quality report was not built", dataset)
+	return nil
+}
+
+func TestIncompleteQuality(t *testing.T) {
+	live, done, _ := testEngine.UseDatabase(cricket.DefaultDataset)
+	done()
+
+	c := defaultConfig()
+	c.MaxQueries = 1
+	c.QueueTimeout = 1
+	e := newEngine(cricket.MustOpen(live.Path), c)
+
+	// With the only slot taken, every check is turned away.
+	release, err := e.Limiter.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report := e.runQualityChecks(cricket.DefaultDataset); !report.Incomplete {
+		t.Errorf("runQualityChecks() with no free slots == %v, want an incomplete report", report)
+	}
+
+	db, done, _ := e.UseDatabase(cricket.DefaultDataset)
+	defer done()
+
+	db.Values.Store(qualityValue, e.runQualityChecks(cricket.DefaultDataset))
+	release()
+
+	// An incomplete report is replaced by the next build.
+	if report := waitForQuality(t, e, cricket.DefaultDataset); len(report.Results) != len(qualityChecks) {
+		t.Errorf("dataQuality() after an incomplete report == %v", report)
+	}
+}
+
+func TestDataQuality(t *testing.T) {
+	waitForQuality(t, testEngine, cricket.DefaultDataset)
+
+	w := httptest.NewRecorder()
+	testServer.handler().ServeHTTP(w, httptest.NewRequest("GET", testServer.baseUrl("/help/data-quality"), nil))
+
+	for _, expected := range []string{"<h2 id=\"missing-matches\">", "Men&#39;s ODI: 2", "m64944", "Open in editor", "No problems found."} {
+		if !strings.Contains(w.Body.String(), expected) {
+			t.Errorf("dataQuality() does not contain %q:\n%s", expected, w.Body.String())
+		}
+	}
+}
@@ -1,11 +1,14 @@
 package main
 
-var savedQueries = map[string]Query{
-	"bannerwell-bowling": Query{
+import "sean.mcgivern.me.uk/cricket-query/cricket"
+
+var savedQueries = map[string]cricket.Query{
+	"bannerwell-bowling": cricket.Query{
 		Subtitle:    "Bowling Bannerwell",
 		Description: "The highest proportion of runs conceded by a bowler in an innings where the opposition were all out.",
-		Formats:     checkboxValues(formatValues, []string{}),
-		Genders:     checkboxValues(genderValues, []string{}),
+		Formats:     cricket.CheckboxValues(cricket.FormatValues, []string{}),
+		Genders:     cricket.CheckboxValues(cricket.GenderValues, []string{}),
+		Dataset:     "",
 		SQL: `WITH
 teams AS (
   SELECT match_id, innings, team, opposition, runs, all_out
@@ -37,11 +40,12 @@ FROM bowling_bannerwell
 ORDER BY proportion DESC
 LIMIT 10;`,
 	},
-	"bannerwell-by-position": Query{
+	"bannerwell-by-position": cricket.Query{
 		Subtitle:    "Bannerwell by position",
 		Description: "Enid Bakewell and Charles Bannerman set their records while opening, which is easy mode. Which players made the biggest proportion of their team's runs from other positions?",
-		Formats:     checkboxValues(formatValues, []string{}),
-		Genders:     checkboxValues(genderValues, []string{}),
+		Formats:     cricket.CheckboxValues(cricket.FormatValues, []string{}),
+		Genders:     cricket.CheckboxValues(cricket.GenderValues, []string{}),
+		Dataset:     "",
 		SQL: `WITH
 teams AS (
   SELECT match_id, innings, runs, all_out
@@ -84,11 +88,12 @@ FROM (
 WHERE rank <= 3 AND pos BETWEEN 3 and 11
 ORDER BY pos, rank;`,
 	},
-	"bannerwell-by-year": Query{
+	"bannerwell-by-year": cricket.Query{
 		Subtitle:    "Bannerwell by year",
 		Description: "The players who made the highest proportion of their team's runs in a calendar year. For Tests, this considers all runs as made on the match's start date, so won't be accurate for matches that span two calendar years.",
-		Formats:     checkboxValues(formatValues, []string{}),
-		Genders:     checkboxValues(genderValues, []string{}),
+		Formats:     cricket.CheckboxValues(cricket.FormatValues, []string{}),
+		Genders:     cricket.CheckboxValues(cricket.GenderValues, []string{}),
+		Dataset:     "",
 		SQL: `WITH
 by_player AS (
   SELECT
@@ -126,11 +131,12 @@ GROUP BY by_player.year, by_player.team, by_player.player
 ORDER BY proportion DESC
 LIMIT 10;`,
 	},
-	"bannerwell": Query{
+	"bannerwell": cricket.Query{
 		Subtitle:    "Bannerwell",
 		Description: "The Bannerwell (Bannerman / Bakewell) is the proportion of runs made in a completed team innings. In the very first men's Test innings, Charles Bannerman made 165 out of 245 for 67%, a record which still stands in men's Tests today. Enid Bakewell bettered that in a women's Test in 1979, with 68% of her team's score.",
-		Formats:     checkboxValues(formatValues, []string{}),
-		Genders:     checkboxValues(genderValues, []string{}),
+		Formats:     cricket.CheckboxValues(cricket.FormatValues, []string{}),
+		Genders:     cricket.CheckboxValues(cricket.GenderValues, []string{}),
+		Dataset:     "",
 		SQL: `WITH
 teams AS (
   SELECT match_id, innings, runs, all_out
@@ -161,11 +167,12 @@ WHERE runs IS NOT NULL
 ORDER BY proportion DESC
 LIMIT 10;`,
 	},
-	"consecutive-wins": Query{
+	"consecutive-wins": cricket.Query{
 		Subtitle:    "Most consecutive wins batting or fielding first",
 		Description: "This shows the most consecutive wins batting or fielding first by format, across all teams. For instance, if team A wins batting first, then teams B and C draw, then team A wins batting first, then team B wins batting first, that's a streak of one win, followed by no streak, followed by a streak of two wins.",
-		Formats:     checkboxValues(formatValues, []string{}),
-		Genders:     checkboxValues(genderValues, []string{}),
+		Formats:     cricket.CheckboxValues(cricket.FormatValues, []string{}),
+		Genders:     cricket.CheckboxValues(cricket.GenderValues, []string{}),
+		Dataset:     "",
 		SQL: `WITH wins AS (
   SELECT
     team,
@@ -195,11 +202,12 @@ GROUP BY first, seq
 ORDER BY count DESC
 LIMIT 20;`,
 	},
-	"converting-centuries-to-doubles": Query{
+	"converting-centuries-to-doubles": cricket.Query{
 		Subtitle:    "Converting centuries to double centuries",
 		Description: "Which players converted the highest ratio of their Test centuries to double centuries.",
-		Formats:     checkboxValues(formatValues, []string{"test"}),
-		Genders:     checkboxValues(genderValues, []string{}),
+		Formats:     cricket.CheckboxValues(cricket.FormatValues, []string{"test"}),
+		Genders:     cricket.CheckboxValues(cricket.GenderValues, []string{}),
+		Dataset:     "",
 		SQL: `WITH counts AS (
   SELECT player_id, player, SUM(CASE WHEN runs >= 100 THEN 1 ELSE 0 END) AS centuries, SUM(CASE WHEN runs >= 200 THEN 1 ELSE 0 END) AS double_centuries
   FROM innings
@@ -211,11 +219,12 @@ WHERE double_centuries >= 1
 ORDER BY ratio DESC
 LIMIT 50;`,
 	},
-	"fewer-runs-than-innings": Query{
+	"fewer-runs-than-innings": cricket.Query{
 		Subtitle:    "Fewer runs than innings",
 		Description: "Players who made it the most innings into their career with fewer than one run per innings.",
-		Formats:     checkboxValues(formatValues, []string{}),
-		Genders:     checkboxValues(genderValues, []string{}),
+		Formats:     cricket.CheckboxValues(cricket.FormatValues, []string{}),
+		Genders:     cricket.CheckboxValues(cricket.GenderValues, []string{}),
+		Dataset:     "",
 		SQL: `WITH
 running AS (
   SELECT
@@ -233,11 +242,12 @@ WHERE cumulative_runs < innings_count
 ORDER BY innings_count DESC
 LIMIT 20;`,
 	},
-	"highest-lowest-cumulative-average": Query{
+	"highest-lowest-cumulative-average": cricket.Query{
 		Subtitle:    "Highest lowest cumulative average",
 		Description: "This shows the lowest average each player had at the end of any innings in their career, and ranks them by that low point.",
-		Formats:     checkboxValues(formatValues, []string{}),
-		Genders:     checkboxValues(genderValues, []string{}),
+		Formats:     cricket.CheckboxValues(cricket.FormatValues, []string{}),
+		Genders:     cricket.CheckboxValues(cricket.GenderValues, []string{}),
+		Dataset:     "",
 		SQL: `WITH
 cumulative AS (
   SELECT
@@ -264,11 +274,12 @@ WHERE total_runs > 1000
 ORDER BY lowest_cumulative_average DESC
 LIMIT 10;`,
 	},
-	"highest-scores-made-n-times": Query{
+	"highest-scores-made-n-times": cricket.Query{
 		Subtitle:    "Highest scores made N times",
 		Description: "The highest score made N (up to 10) times by a single player. Not out scores count here.",
-		Formats:     checkboxValues(formatValues, []string{}),
-		Genders:     checkboxValues(genderValues, []string{}),
+		Formats:     cricket.CheckboxValues(cricket.FormatValues, []string{}),
+		Genders:     cricket.CheckboxValues(cricket.GenderValues, []string{}),
+		Dataset:     "",
 		SQL: `WITH by_count AS (
   SELECT COUNT(*) AS count, runs, player, player_id FROM innings WHERE runs IS NOT NULL GROUP BY runs, player, player_id
 ),
@@ -280,35 +291,22 @@ FROM ranked
 WHERE rank = 1 AND count <= 10
 ORDER BY count ASC;`,
 	},
-	"home-average-difference-batting": Query{
+	"home-average-difference-batting": cricket.Query{
 		Subtitle:    "Biggest difference in home and away batting average",
 		Description: "Players with the biggest difference between their home batting average and their away batting average. Unsurprisingly, most players average more at home. Minimum 1,000 runs.",
-		Formats:     checkboxValues(formatValues, []string{}),
-		Genders:     checkboxValues(genderValues, []string{}),
-		SQL: `WITH ground_counts AS (
-  SELECT ground, team, COUNT(*) AS count FROM team_innings GROUP BY ground, team
-),
-ground_ranks AS (
-  SELECT ground, team, row_number() OVER (PARTITION BY ground ORDER BY count DESC) AS rank FROM ground_counts
-),
-home_grounds AS (
-  SELECT * FROM ground_ranks WHERE rank = 1
-),
-innings_with_home AS (
-  SELECT *, home_grounds.team AS home_team, CASE WHEN not_out = 'True' THEN 0 ELSE 1 END AS out
-  FROM innings
-  INNER JOIN home_grounds ON home_grounds.ground = innings.ground
-  WHERE runs IS NOT NULL
-),
-pivot AS (
+		Formats:     cricket.CheckboxValues(cricket.FormatValues, []string{}),
+		Genders:     cricket.CheckboxValues(cricket.GenderValues, []string{}),
+		Dataset:     "",
+		SQL: `WITH pivot AS (
   SELECT
     player_id,
     player,
-    SUM(CASE WHEN home_team = team THEN runs END) AS home_runs,
-    SUM(CASE WHEN home_team = team THEN out END) AS home_outs,
-    SUM(CASE WHEN home_team != team THEN runs END) AS away_runs,
-    SUM(CASE WHEN home_team != team THEN out END) AS away_outs
-  FROM innings_with_home
+    SUM(runs) FILTER (WHERE home = 'True') AS home_runs,
+    SUM(not_out = 'False') FILTER (WHERE home = 'True') AS home_outs,
+    SUM(runs) FILTER (WHERE home = 'False') AS away_runs,
+    SUM(not_out = 'False') FILTER (WHERE home = 'False') AS away_outs
+  FROM innings
+  WHERE runs IS NOT NULL
   GROUP BY player_id, player
   HAVING home_outs > 0 AND away_outs > 0 AND (home_runs + away_runs >= 1000)
 )
@@ -324,37 +322,24 @@ FROM pivot
 ORDER BY ABS(difference) DESC
 LIMIT 20;`,
 	},
-	"home-average-difference-bowling": Query{
+	"home-average-difference-bowling": cricket.Query{
 		Subtitle:    "Biggest difference in home and away bowling average",
 		Description: "Players with the biggest difference between their home bowling average and their bowling batting average. Unsurprisingly, most players average less at home. Minimum 50 wickets and 10 away innings bowled.",
-		Formats:     checkboxValues(formatValues, []string{}),
-		Genders:     checkboxValues(genderValues, []string{}),
-		SQL: `WITH ground_counts AS (
-  SELECT ground, team, COUNT(*) AS count FROM team_innings GROUP BY ground, team
-),
-ground_ranks AS (
-  SELECT ground, team, row_number() OVER (PARTITION BY ground ORDER BY count DESC) AS rank FROM ground_counts
-),
-home_grounds AS (
-  SELECT * FROM ground_ranks WHERE rank = 1
-),
-innings_with_home AS (
-  SELECT *, home_grounds.team AS home_team
-  FROM bowling_innings
-  INNER JOIN home_grounds ON home_grounds.ground = bowling_innings.ground
-  WHERE runs IS NOT NULL
-),
-pivot AS (
+		Formats:     cricket.CheckboxValues(cricket.FormatValues, []string{}),
+		Genders:     cricket.CheckboxValues(cricket.GenderValues, []string{}),
+		Dataset:     "",
+		SQL: `WITH pivot AS (
   SELECT
     player_id,
     player,
-    SUM(CASE WHEN home_team = team THEN runs END) AS home_runs,
-    SUM(CASE WHEN home_team = team THEN wickets END) AS home_wickets,
-    SUM(CASE WHEN home_team != team THEN runs END) AS away_runs,
-    SUM(CASE WHEN home_team != team THEN wickets END) AS away_wickets
-  FROM innings_with_home
+    SUM(runs) FILTER (WHERE home = 'True') AS home_runs,
+    SUM(wickets) FILTER (WHERE home = 'True') AS home_wickets,
+    SUM(runs) FILTER (WHERE home = 'False') AS away_runs,
+    SUM(wickets) FILTER (WHERE home = 'False') AS away_wickets
+  FROM bowling_innings
+  WHERE runs IS NOT NULL
   GROUP BY player_id, player
-  HAVING home_wickets > 0 AND away_wickets > 0 AND (SUM(CASE WHEN home_team != team THEN 1 ELSE 0 END) >= 10) AND (home_wickets + away_wickets) >= 50
+  HAVING home_wickets > 0 AND away_wickets > 0 AND COUNT(*) FILTER (WHERE home = 'False') >= 10 AND (home_wickets + away_wickets) >= 50
 )
 SELECT
   player_id,
@@ -368,11 +353,12 @@ FROM pivot
 ORDER BY ABS(difference) DESC
 LIMIT 20;`,
 	},
-	"innings-average-difference-biggest": Query{
+	"innings-average-difference-biggest": cricket.Query{
 		Subtitle:    "Biggest difference in first and second innnings average",
 		Description: "Players with the biggest difference between their first innings batting average and their second innings batting average. Unsurprisingly, most players average more in the first innings. Minimum 1,000 runs.",
-		Formats:     checkboxValues(formatValues, []string{"test"}),
-		Genders:     checkboxValues(genderValues, []string{}),
+		Formats:     cricket.CheckboxValues(cricket.FormatValues, []string{"test"}),
+		Genders:     cricket.CheckboxValues(cricket.GenderValues, []string{}),
+		Dataset:     "",
 		SQL: `WITH by_innings AS (
   SELECT
     player_id,
@@ -407,11 +393,12 @@ GROUP BY innings.player_id, player
 ORDER BY ABS(difference) DESC
 LIMIT 20;`,
 	},
-	"innings-average-difference-smallest": Query{
+	"innings-average-difference-smallest": cricket.Query{
 		Subtitle:    "Smallest difference in first and second innnings average",
 		Description: "Players with the smallest difference between their first innings batting average and their second innings batting average. Minimum 1,000 runs.",
-		Formats:     checkboxValues(formatValues, []string{"test"}),
-		Genders:     checkboxValues(genderValues, []string{}),
+		Formats:     cricket.CheckboxValues(cricket.FormatValues, []string{"test"}),
+		Genders:     cricket.CheckboxValues(cricket.GenderValues, []string{}),
+		Dataset:     "",
 		SQL: `WITH by_innings AS (
   SELECT
     player_id,
@@ -446,11 +433,12 @@ GROUP BY innings.player_id, player
 ORDER BY ABS(difference) ASC
 LIMIT 20;`,
 	},
-	"integer-average-before-last-match": Query{
+	"integer-average-before-last-match": cricket.Query{
 		Subtitle:    "Integer average before last match",
 		Description: "Men who had a batting average that was an integer before they played their last Test.",
-		Formats:     checkboxValues(formatValues, []string{}),
-		Genders:     checkboxValues(genderValues, []string{}),
+		Formats:     cricket.CheckboxValues(cricket.FormatValues, []string{}),
+		Genders:     cricket.CheckboxValues(cricket.GenderValues, []string{}),
+		Dataset:     "",
 		SQL: `WITH ranked AS (
   SELECT *, RANK() OVER (PARTITION BY player_id ORDER BY start_date DESC) AS rank FROM innings
 ),
@@ -470,11 +458,12 @@ FROM excluding_last
 WHERE average = CAST(average AS integer) AND (average % 10 = 0 OR average < 10)
 ORDER BY innings DESC;`,
 	},
-	"least-consistent-batters": Query{
+	"least-consistent-batters": cricket.Query{
 		Subtitle:    "Least consistent batters",
 		Description: "The average (mean) is one way of summarising a batter's career. Another is the median, which shows the score that they exceed half the time, and fail to reach half the time. If a genuine batter (defined here as averaging at least 25 with at least 1,000 runs) has a low ratio of median to average, then that suggests they were inconsistent and relied on big scores when they did get in. The shorter the format, the less relevant this is, and the higher the ratio will be. Change ASC to DESC in the SQL to see the most consistent batters by this measure.",
-		Formats:     checkboxValues(formatValues, []string{}),
-		Genders:     checkboxValues(genderValues, []string{}),
+		Formats:     cricket.CheckboxValues(cricket.FormatValues, []string{}),
+		Genders:     cricket.CheckboxValues(cricket.GenderValues, []string{}),
+		Dataset:     "",
 		SQL: `WITH median AS (
   SELECT
     player_id,
@@ -491,11 +480,12 @@ WHERE total >= 1000 AND average >= 25
 ORDER BY median / average ASC
 LIMIT 20;`,
 	},
-	"lowest-batting-average-with-two-double-centuries": Query{
+	"lowest-batting-average-with-two-double-centuries": cricket.Query{
 		Subtitle:    "Lowest batting average with two double centuries",
 		Description: "All players with two double centuries, in reverse order of batting average.",
-		Formats:     checkboxValues(formatValues, []string{"test"}),
-		Genders:     checkboxValues(genderValues, []string{"men"}),
+		Formats:     cricket.CheckboxValues(cricket.FormatValues, []string{"test"}),
+		Genders:     cricket.CheckboxValues(cricket.GenderValues, []string{"men"}),
+		Dataset:     "",
 		SQL: `WITH two_doubles AS (
   SELECT player_id
   FROM innings
@@ -509,11 +499,12 @@ WHERE player_id IN (SELECT player_id FROM two_doubles) AND runs IS NOT NULL
 GROUP BY 1, 2
 ORDER BY average ASC;`,
 	},
-	"lowest-high-score": Query{
+	"lowest-high-score": cricket.Query{
 		Subtitle:    "Lowest high score after N innings",
 		Description: "Players with the lowest high score after N innings.",
-		Formats:     checkboxValues(formatValues, []string{}),
-		Genders:     checkboxValues(genderValues, []string{}),
+		Formats:     cricket.CheckboxValues(cricket.FormatValues, []string{}),
+		Genders:     cricket.CheckboxValues(cricket.GenderValues, []string{}),
+		Dataset:     "",
 		SQL: `WITH
 running AS (
   SELECT
@@ -536,11 +527,12 @@ INNER JOIN running ON cumulative_high_score = lowest_high_score
 WHERE lowest.innings_count IN (10, 25, 50, 100, 200, 300)
 ORDER BY lowest.innings_count;`,
 	},
-	"median-higher-than-average": Query{
+	"median-higher-than-average": cricket.Query{
 		Subtitle:    "Median higher than average",
 		Description: "A player's median innings is the score that they exceed half the time, and fail to reach half the time. Because low scores are so common in cricket, having a median score above the average (mean) score is very rare. This shows the players who made it the most runs into their career with the median above the average",
-		Formats:     checkboxValues(formatValues, []string{}),
-		Genders:     checkboxValues(genderValues, []string{}),
+		Formats:     cricket.CheckboxValues(cricket.FormatValues, []string{}),
+		Genders:     cricket.CheckboxValues(cricket.GenderValues, []string{}),
+		Dataset:     "",
 		SQL: `WITH running AS (
   SELECT
     player_id,
@@ -559,11 +551,12 @@ WHERE median > average
 ORDER BY total DESC
 LIMIT 10;`,
 	},
-	"most-boundary-runs": Query{
+	"most-boundary-runs": cricket.Query{
 		Subtitle:    "Highest proportion of runs in boundaries",
 		Description: "This shows the players with the highest proportion of career runs made in boundaries, where the player has made at least 500 runs in the format.",
-		Formats:     checkboxValues(formatValues, []string{}),
-		Genders:     checkboxValues(genderValues, []string{}),
+		Formats:     cricket.CheckboxValues(cricket.FormatValues, []string{}),
+		Genders:     cricket.CheckboxValues(cricket.GenderValues, []string{}),
+		Dataset:     "",
 		SQL: `WITH
 averages AS (
   SELECT
@@ -586,11 +579,12 @@ WHERE average > 0
 ORDER BY boundary_proportion DESC
 LIMIT 10;`,
 	},
-	"most-innings-outside-most-common-position": Query{
+	"most-innings-outside-most-common-position": cricket.Query{
 		Subtitle:    "Most innings outside most common position",
 		Description: "Players with the highest proportion of innings batted outside their most frequent batting position. For this, both opening positions are considered equivalent. Minimum 100 innings.",
-		Formats:     checkboxValues(formatValues, []string{}),
-		Genders:     checkboxValues(genderValues, []string{}),
+		Formats:     cricket.CheckboxValues(cricket.FormatValues, []string{}),
+		Genders:     cricket.CheckboxValues(cricket.GenderValues, []string{}),
+		Dataset:     "",
 		SQL: `WITH min_twenty AS (
   SELECT player_id FROM innings WHERE runs IS NOT NULL GROUP BY player_id HAVING COUNT(*) >= 100
 ),
@@ -623,11 +617,12 @@ WHERE other_total IS NOT NULL
 ORDER BY ratio ASC
 LIMIT 20;`,
 	},
-	"t20i-innings-with-max-three-overs": Query{
+	"t20i-innings-with-max-three-overs": cricket.Query{
 		Subtitle:    "T20I innings with no bowlers bowling out",
 		Description: "T20I bowling innings where a team bowled all 20 overs, but no individual bowler bowled more than 3 overs.",
-		Formats:     checkboxValues(formatValues, []string{"t20i"}),
-		Genders:     checkboxValues(genderValues, []string{}),
+		Formats:     cricket.CheckboxValues(cricket.FormatValues, []string{"t20i"}),
+		Genders:     cricket.CheckboxValues(cricket.GenderValues, []string{}),
+		Dataset:     "",
 		SQL: `WITH bowling AS (
   SELECT *, CAST(overs AS integer) AS oversn FROM bowling_innings
 )
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"sort"
 	"testing"
 )
 
@@ -9,10 +10,40 @@ func TestSavedQueries(t *testing.T) {
 	ctx := context.Background()
 
 	for key, query := range savedQueries {
-		for _, lr := range projectQuery(ctx, query, rowsLimit, defaultTimeout) {
+		for _, lr := range testEngine.ProjectQuery(ctx, query, testEngine.RowsLimit, testEngine.Timeout) {
 			if len(lr.Result.Messages) > 0 {
 				t.Errorf("Saved query %s (%s) had messages: %v", key, lr.Id, lr.Result.Messages)
 			}
 		}
 	}
 }
+
+// BenchmarkSavedQueries times each saved query across all of its projections.
+// The timeout is raised so that slow queries are measured rather than cut
+// off; scripts/benchmark runs this against the full data with and without
+// the extra indexes.
+func BenchmarkSavedQueries(b *testing.B) {
+	ctx := context.Background()
+	keys := make([]string, 0, len(savedQueries))
+
+	for key := range savedQueries {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		query := savedQueries[key]
+
+		b.Run(key, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				for _, lr := range testEngine.ProjectQuery(ctx, query, testEngine.RowsLimit, 60000) {
+					// Hitting the rows limit is down to the data, not the query.
+					if len(lr.Result.Messages) > 0 && !lr.Result.Truncated {
+						b.Fatalf("Saved query %s (%s) had messages: %v", key, lr.Id, lr.Result.Messages)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"regexp"
+
+	"sean.mcgivern.me.uk/cricket-query/cricket"
+)
+
+var matchProjectedTable = regexp.MustCompile(`\A(?:men|women)_(?:test|odi|t20i)_(batting|bowling|team)_innings\z`)
+
+type SchemaTable struct {
+	Name    string   `json:"name"`
+	Columns []string `json:"columns"`
+}
+
+type SchemaAlias struct {
+	Name    string   `json:"name"`
+	Table   string   `json:"table"`
+	Columns []string `json:"columns"`
+}
+
+type SchemaFunction struct {
+	Name    string `json:"name"`
+	Builtin bool   `json:"builtin"`
+}
+
+type Schema struct {
+	Tables    []SchemaTable    `json:"tables"`
+	Aliases   []SchemaAlias    `json:"aliases"`
+	Functions []SchemaFunction `json:"functions"`
+}
+
+// aliasName returns the alias that addAliases gives to a projected table:
+// `innings` for `men_test_batting_innings`, and so on.
+func aliasName(table string) string {
+	match := matchProjectedTable.FindStringSubmatch(table)
+
+	if match == nil {
+		return ""
+	} else if match[1] == "batting" {
+		return "innings"
+	}
+
+	return match[1] + "_innings"
+}
+
+func (e *Engine) loadSchema(ctx context.Context) (schema Schema, err error) {
+	var tables []string
+	var functions []struct {
+		Name    string `db:"name"`
+		Builtin bool   `db:"builtin"`
+	}
+	aliases := make(map[string]bool)
+
+	db, done, err := e.UseDatabase(cricket.DatasetName(ctx))
+	if err != nil {
+		return
+	}
+	defer done()
+
+	// Shadow tables hold a virtual table's data, like the full-text index
+	// of player names, and aren't meant to be queried directly.
+	err = db.SelectContext(ctx, &tables, `
+SELECT name FROM pragma_table_list
+WHERE schema = 'main' AND type IN ('table', 'view', 'virtual') AND name NOT LIKE 'sqlite_%'
+ORDER BY name;`)
+	if err != nil {
+		return
+	}
+
+	schema.Tables = make([]SchemaTable, 0, len(tables))
+	schema.Aliases = make([]SchemaAlias, 0)
+
+	for _, table := range tables {
+		var columns []string
+
+		err = db.SelectContext(ctx, &columns, "SELECT name FROM pragma_table_info(?) ORDER BY cid;", table)
+		if err != nil {
+			return
+		}
+
+		schema.Tables = append(schema.Tables, SchemaTable{table, columns})
+
+		if alias := aliasName(table); alias != "" && !aliases[alias] {
+			aliases[alias] = true
+			schema.Aliases = append(schema.Aliases, SchemaAlias{
+				alias,
+				"$gender_$format_" + matchProjectedTable.FindStringSubmatch(table)[1] + "_innings",
+				columns,
+			})
+		}
+	}
+
+	err = db.SelectContext(ctx, &functions, `
+SELECT name, MAX(builtin) AS builtin FROM pragma_function_list
+GROUP BY name
+ORDER BY name;`)
+	if err != nil {
+		return
+	}
+
+	schema.Functions = make([]SchemaFunction, 0, len(functions))
+
+	for _, function := range functions {
+		schema.Functions = append(schema.Functions, SchemaFunction{function.Name, function.Builtin})
+	}
+
+	return
+}
+
+func (s *Server) schemaJson(w http.ResponseWriter, r *http.Request) {
+	schema, err := s.engine.loadSchema(r.Context())
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(schema)
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"sean.mcgivern.me.uk/cricket-query/cricket"
+)
+
+func TestAliasName(t *testing.T) {
+	cases := []struct {
+		table    string
+		expected string
+	}{
+		{"men_test_batting_innings", "innings"},
+		{"women_odi_bowling_innings", "bowling_innings"},
+		{"men_t20i_team_innings", "team_innings"},
+		{"men_test_batting", ""},
+		{"innings", ""},
+	}
+
+	for _, c := range cases {
+		if aliasName(c.table) != c.expected {
+			t.Errorf("aliasName(%q) == %v, want %v", c.table, aliasName(c.table), c.expected)
+		}
+	}
+}
+
+func TestLoadSchema(t *testing.T) {
+	schema, err := testEngine.loadSchema(context.Background())
+
+	if err != nil {
+		t.Fatalf("loadSchema(ctx) returned error: %v", err)
+	}
+
+	if len(schema.Tables) != 22 {
+		t.Errorf("loadSchema(ctx) returned %d tables, want 22", len(schema.Tables))
+	}
+
+	aliases := make(map[string]SchemaAlias)
+	for _, alias := range schema.Aliases {
+		aliases[alias.Name] = alias
+	}
+
+	if alias := aliases["innings"]; alias.Table != "$gender_$format_batting_innings" || !inArray("bf", alias.Columns) || !inArray("team_canonical", alias.Columns) {
+		t.Errorf("loadSchema(ctx) innings alias == %v", alias)
+	}
+
+	if len(aliases) != 3 || aliases["bowling_innings"].Name == "" || aliases["team_innings"].Name == "" {
+		t.Errorf("loadSchema(ctx) aliases == %v", schema.Aliases)
+	}
+
+	functions := make(map[string]bool)
+	for _, function := range schema.Functions {
+		functions[function.Name] = function.Builtin
+	}
+
+	if builtin, ok := functions["median"]; !ok || builtin {
+		t.Errorf("loadSchema(ctx) median function == %v, %v", builtin, ok)
+	}
+
+	if builtin, ok := functions["player_id"]; !ok || builtin {
+		t.Errorf("loadSchema(ctx) player_id function == %v, %v", builtin, ok)
+	}
+
+	for _, table := range schema.Tables {
+		if table.Name == "players_fts_data" {
+			t.Errorf("loadSchema(ctx) returned the shadow table %q", table.Name)
+		}
+	}
+
+	if builtin, ok := functions["sum"]; !ok || !builtin {
+		t.Errorf("loadSchema(ctx) sum function == %v, %v", builtin, ok)
+	}
+}
+
+func TestSchemaJson(t *testing.T) {
+	var schema Schema
+	w := httptest.NewRecorder()
+
+	testServer.schemaJson(w, httptest.NewRequest("GET", testServer.baseUrl("/schema.json"), nil))
+
+	if w.Code != 200 || w.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("schemaJson() == %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+
+	if err := json.Unmarshal(w.Body.Bytes(), &schema); err != nil || len(schema.Tables) != 22 {
+		t.Errorf("schemaJson() returned %d tables, error %v", len(schema.Tables), err)
+	}
+}
+
+func TestMappedColumns(t *testing.T) {
+	sql := cricket.AddAliases("women", "odi", `
+SELECT team, team_canonical, opposition_canonical, ground_city, ground_country, home
+FROM team_innings
+WHERE match_id = 'm66864'
+ORDER BY innings;`)
+
+	expected := [][]any{
+		{"Young England", "Young England", "Australia", "Bournemouth", "England", "False"},
+		{"Australia", "Australia", "Young England", "Bournemouth", "England", "False"},
+	}
+
+	result := testEngine.RunQuery(context.Background(), sql, 10, 1000)
+
+	if diff := cmp.Diff(expected, result.Rows); diff != "" || len(result.Messages) > 0 {
+		t.Errorf("mapped columns mismatch (-expected +result):\n%s%v", diff, result.Messages)
+	}
+}
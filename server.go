@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Server serves an Engine over HTTP, along with the permalink store and
+// everything else that isn't about running queries.
+type Server struct {
+	engine  *Engine
+	store   *sqlx.DB
+	config  Config
+	proxies []*net.IPNet
+}
+
+func newServer(c Config, e *Engine, store *sqlx.DB) *Server {
+	// loadConfig has already checked these.
+	proxies, _ := parseNetworks(c.TrustedProxies)
+
+	return &Server{engine: e, store: store, config: c, proxies: proxies}
+}
+
+// handler returns the routes, wrapped to give every request an ID and a
+// client address.
+func (s *Server) handler() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc(s.baseUrl("/"), instrument("index", s.index))
+	mux.HandleFunc(s.baseUrl("/help/"), instrument("help", s.help))
+	mux.HandleFunc(s.baseUrl("/help/data-quality"), instrument("data-quality", s.dataQuality))
+	mux.HandleFunc(s.baseUrl("/compare/"), instrument("compare", s.compare))
+	mux.HandleFunc(s.baseUrl("/player/"), instrument("player", s.player))
+	mux.HandleFunc(s.baseUrl("/match/"), instrument("match", s.match))
+	mux.HandleFunc(s.baseUrl("/head-to-head/"), instrument("head-to-head", s.headToHead))
+	mux.HandleFunc(s.baseUrl("/ground/"), instrument("ground", s.ground))
+	mux.HandleFunc(s.baseUrl("/api/players"), instrument("players", s.playersApi))
+	mux.HandleFunc(s.baseUrl("/static/"), instrument("static", s.static))
+	mux.HandleFunc(s.baseUrl("/schema.json"), instrument("schema", s.schemaJson))
+	mux.HandleFunc(s.baseUrl("/q/"), instrument("permalinks", s.permalinks))
+	mux.HandleFunc(s.baseUrl("/metrics"), instrument("metrics", s.metrics))
+	mux.HandleFunc(s.baseUrl("/healthz"), instrument("healthz", s.healthz))
+	mux.HandleFunc(s.baseUrl("/readyz"), instrument("readyz", s.readyz))
+
+	return withRequestID(withClientIP(mux, s.proxies))
+}
+
+// httpServer returns a server whose request contexts all derive from
+// queriesCtx, so cancelling that cancels every running query.
+func (s *Server) httpServer(queriesCtx context.Context) *http.Server {
+	return &http.Server{
+		Addr:         s.config.listenAddress(),
+		Handler:      s.handler(),
+		ReadTimeout:  milliseconds(s.config.ReadTimeout),
+		WriteTimeout: milliseconds(s.config.WriteTimeout),
+		IdleTimeout:  milliseconds(s.config.IdleTimeout),
+		BaseContext: func(net.Listener) context.Context {
+			return queriesCtx
+		},
+	}
+}
+
+// shutdown stops accepting requests and gives running ones up to drain to
+// finish. After that, it cancels their queries (which makes them return
+// quickly with an error) and waits for the responses to be written.
+func shutdown(server *http.Server, e *Engine, cancelQueries context.CancelFunc, drain time.Duration) {
+	cancelledBefore := e.CancelledQueries()
+
+	logger.Info("shutting down", "drain_ms", drain.Milliseconds(), "active_queries", e.ActiveQueries())
+
+	ctx, cancel := context.WithTimeout(context.Background(), drain)
+	defer cancel()
+
+	if err := server.Shutdown(ctx); err != nil {
+		logger.Warn("cancelling queries", "active_queries", e.ActiveQueries(), "error", err)
+		cancelQueries()
+
+		ctx, cancel := context.WithTimeout(context.Background(), drain)
+		defer cancel()
+
+		if err := server.Shutdown(ctx); err != nil {
+			logger.Warn("closing remaining connections", "error", err)
+			server.Close()
+		}
+	}
+
+	cancelQueries()
+	logger.Info("shut down", "cancelled_queries", e.CancelledQueries()-cancelledBefore)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHandler(t *testing.T) {
+	cases := []struct {
+		path     string
+		status   int
+		contains string
+	}{
+		{"/cricket-query/healthz", 200, "ok"},
+		{"/cricket-query/?sql=SELECT+42+AS+answer%3B&format=test&gender=men", 200, "answer"},
+		{"/cricket-query/q/missing", 404, ""},
+		{"/cricket-query/api/players?q=bannerman", 200, "p4091"},
+		{"/cricket-query/player/p4091", 200, "C Bannerman"},
+		{"/cricket-query/match/m62396", 200, "Australia v England"},
+		{"/cricket-query/head-to-head/?team=Australia&opposition=England", 200, "Australia v England"},
+		{"/cricket-query/ground/?ground=Melbourne", 200, "Melbourne"},
+		{"/elsewhere", 404, ""},
+	}
+
+	handler := testServer.handler()
+
+	for _, c := range cases {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", c.path, nil))
+
+		if w.Code != c.status || !strings.Contains(w.Body.String(), c.contains) {
+			t.Errorf("handler() for %q == %d %q, want %d containing %q", c.path, w.Code, w.Body.String(), c.status, c.contains)
+		}
+
+		if w.Header().Get("X-Request-Id") == "" {
+			t.Errorf("handler() for %q did not set X-Request-Id", c.path)
+		}
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	cancelled := testEngine.CancelledQueries()
+	queriesCtx, cancelQueries := context.WithCancel(context.Background())
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := testServer.httpServer(queriesCtx)
+	server.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		result := testEngine.RunQuery(r.Context(), "WITH RECURSIVE r(i) AS (VALUES(0) UNION ALL SELECT i FROM r LIMIT 100000000) SELECT i FROM r WHERE i = 1;", 1, 10000)
+
+		io.WriteString(w, strings.Join(result.Messages, "\n"))
+	})
+
+	go server.Serve(listener)
+
+	response := make(chan string)
+
+	go func() {
+		res, err := http.Get("http://" + listener.Addr().String())
+
+		if err != nil {
+			response <- err.Error()
+			return
+		}
+
+		body, _ := io.ReadAll(res.Body)
+		response <- string(body)
+	}()
+
+	for testEngine.ActiveQueries() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	start := time.Now()
+	shutdown(server, testEngine, cancelQueries, 50*time.Millisecond)
+
+	if elapsed := time.Now().Sub(start); elapsed > time.Second {
+		t.Errorf("shutdown() took %s", elapsed)
+	}
+
+	if body := <-response; body != "interrupted (9)" {
+		t.Errorf("shutdown() response == %q, want %q", body, "interrupted (9)")
+	}
+
+	if testEngine.CancelledQueries()-cancelled != 1 {
+		t.Errorf("shutdown() cancelled %d queries, want 1", testEngine.CancelledQueries()-cancelled)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+)
+
+var (
+	//go:embed static
+	staticFS embed.FS
+
+	staticAssets = loadStaticAssets(staticFS, "static")
+)
+
+type StaticAsset struct {
+	Path    string
+	Content []byte
+}
+
+// StaticAssets maps the names used in templates (`layout.css`) to
+// content-hashed paths (`layout.1a2b3c4d5e.css`), and those paths back to the
+// file contents. As a path changes whenever its content does, responses can
+// be cached indefinitely.
+type StaticAssets struct {
+	byName map[string]StaticAsset
+	byPath map[string]StaticAsset
+}
+
+func hashedPath(name string, content []byte) string {
+	sum := sha256.Sum256(content)
+	ext := path.Ext(name)
+
+	return fmt.Sprintf("%s.%s%s", strings.TrimSuffix(name, ext), hex.EncodeToString(sum[:5]), ext)
+}
+
+func loadStaticAssets(fsys fs.FS, root string) StaticAssets {
+	assets := StaticAssets{
+		byName: make(map[string]StaticAsset),
+		byPath: make(map[string]StaticAsset),
+	}
+
+	err := fs.WalkDir(fsys, root, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+
+		content, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return err
+		}
+
+		name := strings.TrimPrefix(file, root+"/")
+		asset := StaticAsset{hashedPath(name, content), content}
+
+		assets.byName[name] = asset
+		assets.byPath[asset.Path] = asset
+
+		return nil
+	})
+
+	if err != nil {
+		panic(err)
+	}
+
+	return assets
+}
+
+// hasStatic returns whether every named asset exists, for optional ones
+// like the vendored editor.
+func hasStatic(names ...string) bool {
+	for _, name := range names {
+		if _, ok := staticAssets.byName[name]; !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (s *Server) staticUrl(name string) (string, error) {
+	asset, ok := staticAssets.byName[name]
+
+	if !ok {
+		return "", fmt.Errorf("unknown static asset: %s", name)
+	}
+
+	return s.baseUrl("/static/" + asset.Path), nil
+}
+
+func (s *Server) static(w http.ResponseWriter, r *http.Request) {
+	asset, ok := staticAssets.byPath[strings.TrimPrefix(r.URL.Path, s.baseUrl("/static/"))]
+
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	if contentType := mime.TypeByExtension(path.Ext(asset.Path)); contentType != "" {
+		w.Header().Set("Content-Type", contentType)
+	}
+
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	w.Write(asset.Content)
+}
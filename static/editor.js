@@ -0,0 +1,84 @@
+var editor = ace.edit('editor', {
+  mode: 'ace/mode/sql',
+  theme: 'ace/theme/chrome',
+  maxLines: 1000,
+  showLineNumbers: false,
+  showGutter: false,
+  enableBasicAutocompletion: true,
+  enableLiveAutocompletion: true
+});
+
+var textarea = document.querySelector('textarea[name="sql"]');
+
+textarea.style.display = 'none';
+
+editor.className = 'editor-loaded';
+editor.setValue(textarea.value, -1);
+editor.session.on('change', function() {
+  textarea.value = editor.getSession().getValue();
+});
+
+// Completions come from the live database schema: aliases, full table names,
+// their columns, and functions (including custom ones like median). After a
+// `table.` or `alias.`, only that table's columns are offered.
+(function() {
+  var schemaUrl = document.getElementById('editor').dataset.schema;
+  var languageTools = ace.require('ace/ext/language_tools');
+
+  if (!languageTools || !schemaUrl) {
+    return;
+  }
+
+  fetch(schemaUrl).then(function(response) {
+    return response.json();
+  }).then(function(schema) {
+    var all = [];
+    var columnsByTable = {};
+    var seenColumns = {};
+
+    function addColumns(table, columns) {
+      columnsByTable[table.toLowerCase()] = columns.map(function(column) {
+        return { caption: column, value: column, meta: table, score: 1000 };
+      });
+
+      columns.forEach(function(column) {
+        if (!seenColumns[column]) {
+          seenColumns[column] = true;
+          all.push({ caption: column, value: column, meta: 'column', score: 600 });
+        }
+      });
+    }
+
+    schema.aliases.forEach(function(alias) {
+      all.push({ caption: alias.name, value: alias.name, meta: 'alias', score: 900 });
+      addColumns(alias.name, alias.columns);
+    });
+
+    schema.tables.forEach(function(table) {
+      all.push({ caption: table.name, value: table.name, meta: 'table', score: 800 });
+      addColumns(table.name, table.columns);
+    });
+
+    schema.functions.forEach(function(fn) {
+      all.push({
+        caption: fn.name + '()',
+        value: fn.name + '(',
+        meta: fn.builtin ? 'function' : 'custom function',
+        score: fn.builtin ? 500 : 700
+      });
+    });
+
+    languageTools.addCompleter({
+      getCompletions: function(editor, session, pos, prefix, callback) {
+        var line = session.getLine(pos.row).slice(0, pos.column - prefix.length);
+        var qualified = line.match(/(\w+)\.$/);
+
+        if (qualified) {
+          callback(null, columnsByTable[qualified[1].toLowerCase()] || []);
+        } else {
+          callback(null, all);
+        }
+      }
+    });
+  });
+})();
@@ -0,0 +1,159 @@
+// Keeps the queries run in this browser in local storage, and lists them in
+// the history panel with links to re-run them and a diff against the SQL
+// currently in the editor.
+(function() {
+  var storageKey = 'cricket-query:history';
+  var maxEntries = 50;
+  var panel = document.getElementById('history');
+  var current = JSON.parse(document.getElementById('history-entry').textContent);
+  var form = document.querySelector('form');
+  var textarea = document.querySelector('textarea[name="sql"]');
+  var history;
+
+  try {
+    history = JSON.parse(window.localStorage.getItem(storageKey) || '[]');
+  } catch (e) {
+    return;
+  }
+
+  function sameQuery(a, b) {
+    return a.sql === b.sql &&
+      a.formats.join(',') === b.formats.join(',') &&
+      a.genders.join(',') === b.genders.join(',') &&
+      (a.dataset || '') === (b.dataset || '');
+  }
+
+  if (current.projections.length > 0 && (history.length === 0 || !sameQuery(history[0], current))) {
+    current.timestamp = Date.now();
+    history.unshift(current);
+    history = history.slice(0, maxEntries);
+
+    try {
+      window.localStorage.setItem(storageKey, JSON.stringify(history));
+    } catch (e) {}
+  }
+
+  function rerunUrl(entry) {
+    var params = new URLSearchParams();
+
+    params.append('sql', entry.sql);
+    entry.formats.forEach(function(format) { params.append('format', format); });
+    entry.genders.forEach(function(gender) { params.append('gender', gender); });
+
+    if (entry.dataset) {
+      params.append('dataset', entry.dataset);
+    }
+
+    return form.getAttribute('action') + '?' + params.toString();
+  }
+
+  // A line-based diff using the longest common subsequence; queries are
+  // short enough that the quadratic table doesn't matter.
+  function diffLines(before, after) {
+    var a = before.split('\n');
+    var b = after.split('\n');
+    var lcs = [];
+    var out = [];
+    var i, j;
+
+    for (i = a.length; i >= 0; i--) {
+      lcs[i] = [];
+
+      for (j = b.length; j >= 0; j--) {
+        if (i === a.length || j === b.length) {
+          lcs[i][j] = 0;
+        } else if (a[i] === b[j]) {
+          lcs[i][j] = lcs[i + 1][j + 1] + 1;
+        } else {
+          lcs[i][j] = Math.max(lcs[i + 1][j], lcs[i][j + 1]);
+        }
+      }
+    }
+
+    for (i = 0, j = 0; i < a.length || j < b.length;) {
+      if (i < a.length && j < b.length && a[i] === b[j]) {
+        out.push({ op: ' ', line: a[i] });
+        i++;
+        j++;
+      } else if (j < b.length && (i === a.length || lcs[i][j + 1] >= lcs[i + 1][j])) {
+        out.push({ op: '+', line: b[j] });
+        j++;
+      } else {
+        out.push({ op: '-', line: a[i] });
+        i++;
+      }
+    }
+
+    return out;
+  }
+
+  function showDiff(entry) {
+    var pre = panel.querySelector('.history-diff');
+
+    pre.textContent = '';
+
+    diffLines(entry.sql, textarea.value).forEach(function(change) {
+      var node = document.createElement(change.op === '+' ? 'ins' : change.op === '-' ? 'del' : 'span');
+
+      node.textContent = change.op + ' ' + change.line + '\n';
+      pre.appendChild(node);
+    });
+
+    pre.hidden = false;
+  }
+
+  function describe(entry) {
+    var rows = 0;
+    var duration = 0;
+    var flags = [];
+
+    entry.projections.forEach(function(projection) {
+      rows += projection.rows;
+      duration += projection.duration;
+
+      if (projection.truncated) {
+        flags.push(projection.header + ' truncated');
+      } else if (projection.failed) {
+        flags.push(projection.header + ' failed');
+      }
+    });
+
+    return [
+      new Date(entry.timestamp).toLocaleString()
+    ].concat(entry.dataset ? [entry.dataset] : []).concat([
+      entry.projections.map(function(projection) { return projection.header; }).join(', '),
+      rows + (rows === 1 ? ' row' : ' rows'),
+      duration + 'ms'
+    ]).concat(flags).join(' · ');
+  }
+
+  history.forEach(function(entry, index) {
+    var item = document.createElement('li');
+    var summary = document.createElement('div');
+    var sql = document.createElement('code');
+    var rerun = document.createElement('a');
+    var diff = document.createElement('span');
+
+    summary.textContent = (entry.subtitle ? entry.subtitle + ' · ' : '') + describe(entry) + (index === 0 && entry === current ? ' (this page)' : '');
+    sql.textContent = entry.sql;
+    sql.title = entry.sql;
+
+    rerun.href = rerunUrl(entry);
+    rerun.textContent = 'Re-run';
+
+    diff.className = 'click';
+    diff.textContent = 'Diff with current SQL';
+    diff.addEventListener('click', function() {
+      showDiff(entry);
+    });
+
+    item.appendChild(summary);
+    item.appendChild(sql);
+    item.appendChild(rerun);
+    item.appendChild(document.createTextNode(' · '));
+    item.appendChild(diff);
+    panel.querySelector('ol').appendChild(item);
+  });
+
+  panel.hidden = false;
+})();
@@ -0,0 +1,74 @@
+(function() {
+  var matchNumber = /^-?\d+(\.\d+)?$/;
+
+  function compare(a, b) {
+    if (a === b) {
+      return 0;
+    } else if (a === '') {
+      return 1;
+    } else if (b === '') {
+      return -1;
+    } else if (matchNumber.test(a) && matchNumber.test(b)) {
+      return parseFloat(a) - parseFloat(b);
+    }
+
+    return a.localeCompare(b);
+  }
+
+  function sortBy(table, th, index) {
+    var tbody = table.tBodies[0];
+    var rows = Array.prototype.slice.call(tbody.rows);
+    var descending = th.classList.contains('sort-asc');
+
+    Array.prototype.forEach.call(table.tHead.rows[0].cells, function(cell) {
+      cell.classList.remove('sort-asc', 'sort-desc');
+    });
+
+    th.classList.add(descending ? 'sort-desc' : 'sort-asc');
+
+    rows.sort(function(a, b) {
+      var result = compare(a.cells[index].dataset.sort, b.cells[index].dataset.sort);
+
+      return descending ? -result : result;
+    });
+
+    rows.forEach(function(row) {
+      tbody.appendChild(row);
+    });
+  }
+
+  function filter(table, text) {
+    var needle = text.toLowerCase();
+
+    Array.prototype.forEach.call(table.tBodies[0].rows, function(row) {
+      row.hidden = needle !== '' && row.textContent.toLowerCase().indexOf(needle) === -1;
+    });
+  }
+
+  document.querySelectorAll('table.sortable').forEach(function(table) {
+    if (!table.tHead || !table.tBodies[0] || table.tBodies[0].rows.length < 2) {
+      return;
+    }
+
+    Array.prototype.forEach.call(table.tHead.rows[0].cells, function(th, index) {
+      th.classList.add('sort');
+      th.title = 'Sort by ' + th.textContent;
+      th.addEventListener('click', function() {
+        sortBy(table, th, index);
+      });
+    });
+
+    var container = document.createElement('p');
+    var input = document.createElement('input');
+
+    container.className = 'table-filter';
+    input.type = 'search';
+    input.placeholder = 'Filter rows';
+    input.addEventListener('input', function() {
+      filter(table, input.value);
+    });
+
+    container.appendChild(input);
+    table.parentNode.insertBefore(container, table);
+  });
+})();
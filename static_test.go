@@ -0,0 +1,89 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHashedPath(t *testing.T) {
+	cases := []struct {
+		name     string
+		content  string
+		expected string
+	}{
+		{"layout.css", "", "layout.e3b0c44298.css"},
+		{"ace/ace.js", "", "ace/ace.e3b0c44298.js"},
+		{"ace/ace.js", "ace", "ace/ace.2a0b6287a0.js"},
+		{"LICENSE", "", "LICENSE.e3b0c44298"},
+	}
+
+	for _, c := range cases {
+		if hashedPath(c.name, []byte(c.content)) != c.expected {
+			t.Errorf("hashedPath(%q, %q) == %v, want %v", c.name, c.content, hashedPath(c.name, []byte(c.content)), c.expected)
+		}
+	}
+}
+
+// The editor falls back to a textarea without Ace, so a build that forgot
+// to vendor it would otherwise look like it works.
+func TestVendoredAce(t *testing.T) {
+	for _, name := range []string{"ace/ace.js", "ace/mode-sql.js", "ace/theme-chrome.js", "ace/ext-language_tools.js"} {
+		if !hasStatic(name) {
+			t.Errorf("hasStatic(%q) == false; run scripts/vendor-ace and commit static/ace", name)
+		}
+	}
+}
+
+func TestHasStatic(t *testing.T) {
+	cases := []struct {
+		names    []string
+		expected bool
+	}{
+		{[]string{"layout.css"}, true},
+		{[]string{"layout.css", "editor.js"}, true},
+		{[]string{"layout.css", "missing.js"}, false},
+		{[]string{"missing.js"}, false},
+	}
+
+	for _, c := range cases {
+		if result := hasStatic(c.names...); result != c.expected {
+			t.Errorf("hasStatic(%v) == %v, want %v", c.names, result, c.expected)
+		}
+	}
+}
+
+func TestStaticUrl(t *testing.T) {
+	url, err := testServer.staticUrl("layout.css")
+
+	if err != nil || url != testServer.baseUrl("/static/"+staticAssets.byName["layout.css"].Path) {
+		t.Errorf("staticUrl(%q) == %v, %v", "layout.css", url, err)
+	}
+
+	if _, err := testServer.staticUrl("missing.css"); err == nil {
+		t.Errorf("staticUrl(%q) did not return an error", "missing.css")
+	}
+}
+
+func TestStatic(t *testing.T) {
+	hashed, _ := testServer.staticUrl("layout.css")
+
+	cases := []struct {
+		url          string
+		status       int
+		contentType  string
+		cacheControl string
+	}{
+		{hashed, 200, "text/css; charset=utf-8", "public, max-age=31536000, immutable"},
+		{testServer.baseUrl("/static/layout.css"), 404, "text/plain; charset=utf-8", ""},
+		{testServer.baseUrl("/static/missing.css"), 404, "text/plain; charset=utf-8", ""},
+	}
+
+	for _, c := range cases {
+		w := httptest.NewRecorder()
+		testServer.static(w, httptest.NewRequest("GET", c.url, nil))
+
+		if w.Code != c.status || w.Header().Get("Content-Type") != c.contentType || w.Header().Get("Cache-Control") != c.cacheControl {
+			t.Errorf("static(%q) == %d %q %q, want %d %q %q", c.url, w.Code, w.Header().Get("Content-Type"), w.Header().Get("Cache-Control"), c.status, c.contentType, c.cacheControl)
+		}
+	}
+}
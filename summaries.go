@@ -0,0 +1,328 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"sean.mcgivern.me.uk/cricket-query/cricket"
+)
+
+// allProjections is every projection, for pages that cover them all.
+func allProjections() (out []string) {
+	for _, gender := range cricket.GenderValues {
+		for _, format := range cricket.FormatValues {
+			out = append(out, fmt.Sprintf("%s-%s", gender.Value, format.Value))
+		}
+	}
+
+	return
+}
+
+// headToHeadSections are about $team's matches against $opposition. Those
+// that aren't from one side's point of view include both teams' innings.
+var headToHeadSections = []PageSection{
+	{
+		"results",
+		"Results",
+		`WITH matches AS (
+  SELECT match_id, max(result) AS result
+  FROM team_innings
+  WHERE team = $team AND opposition = $opposition
+  GROUP BY match_id
+)
+SELECT
+  count(*) AS matches,
+  sum(CASE WHEN result = 'won' THEN 1 ELSE 0 END) AS won,
+  sum(CASE WHEN result = 'lost' THEN 1 ELSE 0 END) AS lost,
+  sum(CASE WHEN result = 'draw' THEN 1 ELSE 0 END) AS drawn,
+  sum(CASE WHEN result NOT IN ('won', 'lost', 'draw') THEN 1 ELSE 0 END) AS other,
+  min(start_date) AS first,
+  max(start_date) AS last
+FROM matches
+INNER JOIN (SELECT DISTINCT match_id, start_date FROM team_innings) USING (match_id)
+HAVING count(*) > 0`,
+	},
+	{
+		"highest-totals",
+		"Highest totals",
+		`SELECT team, score, overs, innings, ground, start_date, match_id
+FROM team_innings
+WHERE ((team = $team AND opposition = $opposition) OR (team = $opposition AND opposition = $team)) AND runs IS NOT NULL
+ORDER BY runs DESC, start_date
+LIMIT 5`,
+	},
+	{
+		"lowest-totals",
+		"Lowest completed totals",
+		`SELECT team, score, overs, innings, ground, start_date, match_id
+FROM team_innings
+WHERE ((team = $team AND opposition = $opposition) OR (team = $opposition AND opposition = $team)) AND all_out = 'True'
+ORDER BY runs ASC, start_date
+LIMIT 5`,
+	},
+	{
+		"run-scorers",
+		"Most runs",
+		`SELECT
+  player,
+  player_id,
+  team,
+  count(DISTINCT match_id) AS matches,
+  sum(runs) AS runs,
+  CAST(sum(runs) AS real) / nullif(sum(CASE WHEN runs IS NOT NULL AND not_out = 'False' THEN 1 ELSE 0 END), 0) AS average,
+  max(runs) AS highest
+FROM innings
+WHERE (team = $team AND opposition = $opposition) OR (team = $opposition AND opposition = $team)
+GROUP BY player_id, player, team
+HAVING sum(runs) > 0
+ORDER BY runs DESC
+LIMIT 10`,
+	},
+	{
+		"wicket-takers",
+		"Most wickets",
+		`SELECT
+  player,
+  player_id,
+  team,
+  count(DISTINCT match_id) AS matches,
+  sum(wickets) AS wickets,
+  CAST(sum(runs) AS real) / nullif(sum(wickets), 0) AS average,
+  6.0 * sum(runs) / nullif(sum(balls), 0) AS economy
+FROM bowling_innings
+WHERE ((team = $team AND opposition = $opposition) OR (team = $opposition AND opposition = $team)) AND balls IS NOT NULL
+GROUP BY player_id, player, team
+HAVING sum(wickets) > 0
+ORDER BY wickets DESC, average ASC
+LIMIT 10`,
+	},
+	{
+		"batting-first",
+		"Batting first or chasing",
+		`SELECT
+  CASE WHEN batted_first THEN 'Batting first' ELSE 'Chasing' END AS innings,
+  count(*) AS matches,
+  sum(CASE WHEN result = 'won' THEN 1 ELSE 0 END) AS won,
+  100.0 * sum(CASE WHEN result = 'won' THEN 1 ELSE 0 END) / count(*) AS win_percentage
+FROM (
+  SELECT match_id, max(result) AS result, min(innings) = 1 AS batted_first
+  FROM team_innings
+  WHERE team = $team AND opposition = $opposition
+  GROUP BY match_id
+)
+GROUP BY batted_first
+ORDER BY batted_first DESC`,
+	},
+}
+
+// groundSections are about every match at $ground.
+var groundSections = []PageSection{
+	{
+		"results",
+		"Results by team",
+		`WITH matches AS (
+  SELECT team, match_id, max(result) AS result
+  FROM team_innings
+  WHERE ground = $ground
+  GROUP BY team, match_id
+)
+SELECT
+  team,
+  count(*) AS matches,
+  sum(CASE WHEN result = 'won' THEN 1 ELSE 0 END) AS won,
+  sum(CASE WHEN result = 'lost' THEN 1 ELSE 0 END) AS lost,
+  sum(CASE WHEN result = 'draw' THEN 1 ELSE 0 END) AS drawn,
+  sum(CASE WHEN result NOT IN ('won', 'lost', 'draw') THEN 1 ELSE 0 END) AS other
+FROM matches
+GROUP BY team
+ORDER BY matches DESC, team`,
+	},
+	{
+		"highest-totals",
+		"Highest totals",
+		`SELECT team, score, overs, innings, opposition, start_date, match_id
+FROM team_innings
+WHERE ground = $ground AND runs IS NOT NULL
+ORDER BY runs DESC, start_date
+LIMIT 5`,
+	},
+	{
+		"lowest-totals",
+		"Lowest completed totals",
+		`SELECT team, score, overs, innings, opposition, start_date, match_id
+FROM team_innings
+WHERE ground = $ground AND all_out = 'True'
+ORDER BY runs ASC, start_date
+LIMIT 5`,
+	},
+	{
+		"run-scorers",
+		"Most runs",
+		`SELECT
+  player,
+  player_id,
+  team,
+  count(DISTINCT match_id) AS matches,
+  sum(runs) AS runs,
+  CAST(sum(runs) AS real) / nullif(sum(CASE WHEN runs IS NOT NULL AND not_out = 'False' THEN 1 ELSE 0 END), 0) AS average,
+  max(runs) AS highest
+FROM innings
+WHERE ground = $ground
+GROUP BY player_id, player, team
+HAVING sum(runs) > 0
+ORDER BY runs DESC
+LIMIT 10`,
+	},
+	{
+		"wicket-takers",
+		"Most wickets",
+		`SELECT
+  player,
+  player_id,
+  team,
+  count(DISTINCT match_id) AS matches,
+  sum(wickets) AS wickets,
+  CAST(sum(runs) AS real) / nullif(sum(wickets), 0) AS average,
+  6.0 * sum(runs) / nullif(sum(balls), 0) AS economy
+FROM bowling_innings
+WHERE ground = $ground AND balls IS NOT NULL
+GROUP BY player_id, player, team
+HAVING sum(wickets) > 0
+ORDER BY wickets DESC, average ASC
+LIMIT 10`,
+	},
+	{
+		"batting-first",
+		"Batting first or chasing",
+		`SELECT
+  CASE result WHEN 'won' THEN 'Batting first' WHEN 'lost' THEN 'Chasing' ELSE result END AS winner,
+  count(*) AS matches,
+  100.0 * count(*) / sum(count(*)) OVER () AS percentage
+FROM team_innings
+WHERE ground = $ground AND innings = 1
+GROUP BY 1
+ORDER BY matches DESC`,
+	},
+}
+
+// TeamsAndGrounds is every team and ground in a database's team tables,
+// to suggest in the forms.
+type TeamsAndGrounds struct {
+	Teams   []string
+	Grounds []string
+}
+
+// teamsAndGrounds lists the teams and grounds in the dataset in ctx. They
+// only change when the database does, so the lists are kept with it once
+// both queries have run.
+func (e *Engine) teamsAndGrounds(ctx context.Context) (lists TeamsAndGrounds, err error) {
+	var parts []string
+
+	db, done, err := e.UseDatabase(cricket.DatasetName(ctx))
+	if err != nil {
+		return
+	}
+	defer done()
+
+	if cached, ok := db.Values.Load(teamsAndGroundsValue); ok {
+		return cached.(TeamsAndGrounds), nil
+	}
+
+	for _, id := range allProjections() {
+		parts = append(parts, fmt.Sprintf("SELECT team, ground FROM %s_team_innings", strings.ReplaceAll(id, "-", "_")))
+	}
+
+	union := strings.Join(parts, "\nUNION\n")
+
+	if err = e.SelectRows(ctx, "summary", &lists.Teams, fmt.Sprintf("SELECT DISTINCT team FROM (%s) ORDER BY team;", union)); err != nil {
+		return
+	}
+
+	if err = e.SelectRows(ctx, "summary", &lists.Grounds, fmt.Sprintf("SELECT DISTINCT ground FROM (%s) ORDER BY ground;", union)); err != nil {
+		return
+	}
+
+	db.Values.Store(teamsAndGroundsValue, lists)
+
+	return
+}
+
+// showSummary runs the sections when every parameter has a value, and
+// shows them with a form to choose others.
+func (s *Server) showSummary(w http.ResponseWriter, r *http.Request, title string, sections []PageSection, params map[string]string) {
+	var results []SectionResult
+
+	dataset, ok := s.requestDataset(w, r, r.FormValue("dataset"))
+	if !ok {
+		return
+	}
+
+	ctx := cricket.WithDataset(r.Context(), dataset.Name)
+	ready := true
+
+	for _, value := range params {
+		ready = ready && value != ""
+	}
+
+	if ready {
+		results = s.engine.runSections(ctx, sections, params, allProjections())
+		s.linkSections(results, allProjections(), dataset.Name)
+	}
+
+	messages := make([]string, 0)
+	lists, err := s.engine.teamsAndGrounds(ctx)
+
+	if err != nil {
+		messages = append(messages, err.Error())
+	}
+
+	s.executeTemplate(w, "summary.html", Page{
+		Title: title,
+		Content: struct {
+			Path     string
+			Params   map[string]string
+			Results  []SectionResult
+			Teams    []string
+			Grounds  []string
+			Messages []string
+			Datasets []cricket.Dataset
+			Dataset  cricket.Dataset
+		}{
+			r.URL.Path,
+			params,
+			results,
+			lists.Teams,
+			lists.Grounds,
+			messages,
+			s.engine.Datasets,
+			dataset,
+		},
+	})
+}
+
+// headToHead shows team's record against opposition.
+func (s *Server) headToHead(w http.ResponseWriter, r *http.Request) {
+	team := strings.TrimSpace(r.FormValue("team"))
+	opposition := strings.TrimSpace(r.FormValue("opposition"))
+	title := "Head to head"
+
+	if team != "" && opposition != "" {
+		title = fmt.Sprintf("%s v %s", team, opposition)
+	}
+
+	s.showSummary(w, r, title, headToHeadSections, map[string]string{"$team": team, "$opposition": opposition})
+}
+
+// ground shows the record of every match at a ground.
+func (s *Server) ground(w http.ResponseWriter, r *http.Request) {
+	ground := strings.TrimSpace(r.FormValue("ground"))
+	title := "Grounds"
+
+	if ground != "" {
+		title = ground
+	}
+
+	s.showSummary(w, r, title, groundSections, map[string]string{"$ground": ground})
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"sean.mcgivern.me.uk/cricket-query/cricket"
+)
+
+func TestAllProjections(t *testing.T) {
+	expected := []string{"men-test", "men-odi", "men-t20i", "women-test", "women-odi", "women-t20i"}
+
+	if diff := cmp.Diff(expected, allProjections()); diff != "" {
+		t.Errorf("allProjections() mismatch (-expected +result):\n%s", diff)
+	}
+}
+
+func TestSummarySections(t *testing.T) {
+	cases := []struct {
+		sections []PageSection
+		params   map[string]string
+	}{
+		{headToHeadSections, map[string]string{"$team": "Australia", "$opposition": "England"}},
+		{groundSections, map[string]string{"$ground": "Melbourne"}},
+	}
+
+	for _, c := range cases {
+		results := testEngine.runSections(context.Background(), c.sections, c.params, allProjections())
+
+		for _, result := range results {
+			if len(result.Result.Messages) > 0 {
+				t.Errorf("runSections(%v) section %q returned %v", c.params, result.Section.Id, result.Result.Messages)
+			}
+
+			if strings.Contains(result.SQL, "$") {
+				t.Errorf("runSections(%v) section %q left a parameter in %q", c.params, result.Section.Id, result.SQL)
+			}
+		}
+	}
+
+	results := testEngine.runSections(context.Background(), headToHeadSections, map[string]string{"$team": "Australia", "$opposition": "England"}, allProjections())
+	expected := []any{"Men's Test", int64(2), int64(1), int64(1), int64(0), int64(0)}
+
+	if diff := cmp.Diff(expected, results[0].Result.Rows[0][:6]); diff != "" {
+		t.Errorf("head to head results mismatch (-expected +result):\n%s", diff)
+	}
+}
+
+func TestTeamsAndGrounds(t *testing.T) {
+	live, done, _ := testEngine.UseDatabase(cricket.DefaultDataset)
+	done()
+
+	config := defaultConfig()
+	config.MaxQueries = 1
+	config.QueueTimeout = 1
+	e := newEngine(cricket.MustOpen(live.Path), config)
+
+	// Turned away by the limiter, the lists aren't kept.
+	release, err := e.Limiter.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if lists, err := e.teamsAndGrounds(context.Background()); err != cricket.ErrServerBusy {
+		t.Errorf("teamsAndGrounds() with no free slots == %v, %v, want %v", lists, err, cricket.ErrServerBusy)
+	}
+
+	release()
+
+	lists, err := e.teamsAndGrounds(context.Background())
+
+	if err != nil || !inArray("Australia", lists.Teams) || !inArray("England", lists.Teams) || !inArray("Melbourne", lists.Grounds) {
+		t.Errorf("teamsAndGrounds() == %v, %v", lists, err)
+	}
+
+	db, done, _ := e.UseDatabase(cricket.DefaultDataset)
+	defer done()
+
+	if cached, ok := db.Values.Load(teamsAndGroundsValue); !ok || !cmp.Equal(cached, lists) {
+		t.Errorf("teamsAndGrounds() kept %v, want %v", cached, lists)
+	}
+}
+
+func TestSummaryPages(t *testing.T) {
+	cases := []struct {
+		path     string
+		expected []string
+		missing  []string
+	}{
+		{"/head-to-head/", []string{`<input type="text" name="team" id="team" value=""`, `<option value="Australia">`}, []string{"<h2"}},
+		{"/head-to-head/?team=Australia", []string{`value="Australia"`}, []string{"<h2"}},
+		{
+			"/head-to-head/?team=Australia&opposition=England",
+			[]string{"<h1>Australia v England</h1>", `<h2 id="results">Results`, `<h2 id="batting-first">Batting first or chasing`, "Open in editor</a>"},
+			nil,
+		},
+		{"/ground/", []string{`<input type="text" name="ground" id="ground" value=""`, `<option value="Melbourne">`}, []string{"<h2"}},
+		{"/ground/?ground=Melbourne", []string{"<h1>Melbourne</h1>", `<h2 id="wicket-takers">Most wickets`}, nil},
+	}
+
+	for _, c := range cases {
+		w := httptest.NewRecorder()
+		testServer.handler().ServeHTTP(w, httptest.NewRequest("GET", testServer.baseUrl(c.path), nil))
+		body := w.Body.String()
+
+		if w.Code != 200 {
+			t.Errorf("GET %s returned %d", c.path, w.Code)
+		}
+
+		for _, expected := range c.expected {
+			if !strings.Contains(body, expected) {
+				t.Errorf("GET %s did not contain %q", c.path, expected)
+			}
+		}
+
+		for _, missing := range c.missing {
+			if strings.Contains(body, missing) {
+				t.Errorf("GET %s contained %q", c.path, missing)
+			}
+		}
+	}
+}